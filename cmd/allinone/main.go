@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/joho/godotenv"
+	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/broker"
+	"go-challenge-financial-chat/internal/chat"
+	"go-challenge-financial-chat/internal/config"
+	"go-challenge-financial-chat/internal/database"
+	"go-challenge-financial-chat/internal/handlers"
+	"go-challenge-financial-chat/internal/stock"
+	"log"
+	"net/http"
+	"os"
+)
+
+/*
+allinone runs the HTTP server, the chat hub and the stock bot in a single process, using an in-memory broker
+and a SQLite database by default so it needs neither Kafka nor MySQL
+*/
+func main() {
+	if err := godotenv.Load(".env"); err != nil {
+		log.Println("No .env file found, using environment and defaults")
+	}
+
+	db, err := database.Open(getEnv("DATABASE_URL", "sqlite://chat.db"))
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
+	b := broker.NewMemory()
+	defer b.Close()
+
+	provider, err := stock.NewProvider(os.Getenv("STOCK_PROVIDER"), os.Getenv("STOOQ_BASE_URL"), os.Getenv("STOCK_FIXTURES"))
+	if err != nil {
+		log.Fatal("Failed to create stock quote provider:", err)
+	}
+
+	stockService := stock.NewService(b, provider)
+	defer stockService.Close()
+	go stockService.Start()
+
+	sessionSecret, err := config.SessionSecret()
+	if err != nil {
+		log.Fatal("Failed to load session secret:", err)
+	}
+
+	limits, err := config.RateLimits()
+	if err != nil {
+		log.Fatal("Invalid rate limits: ", err)
+	}
+
+	authService := auth.NewService(db, sessionSecret)
+	hub := chat.NewHub(db, b, limits)
+	go hub.Run()
+
+	h := handlers.New(authService, hub, db)
+	router := h.SetupRoutes()
+
+	port := getEnv("SERVER_PORT", ":8080")
+	log.Printf("All-in-one server starting on %s", port)
+	log.Fatal(http.ListenAndServe(port, router))
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/joho/godotenv"
+	"go-challenge-financial-chat/internal/broker"
 	"go-challenge-financial-chat/internal/stock"
 	"log"
 	"os"
@@ -14,7 +15,15 @@ func main() {
 		panic("Error loading env file")
 	}
 
-	stockService := stock.NewService(os.Getenv("KAFKA_BROKERS"))
+	provider, err := stock.NewProvider(os.Getenv("STOCK_PROVIDER"), os.Getenv("STOOQ_BASE_URL"), os.Getenv("STOCK_FIXTURES"))
+	if err != nil {
+		log.Fatal("Failed to create stock quote provider:", err)
+	}
+
+	b := broker.NewKafka(os.Getenv("KAFKA_BROKERS"))
+	defer b.Close()
+
+	stockService := stock.NewService(b, provider)
 	defer stockService.Close()
 
 	c := make(chan os.Signal, 1)
@@ -24,6 +33,7 @@ func main() {
 		<-c
 		log.Println("Shutting down stock bot...")
 		stockService.Close()
+		b.Close()
 		os.Exit(0)
 	}()
 
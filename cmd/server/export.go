@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-challenge-financial-chat/internal/database"
+	"go-challenge-financial-chat/internal/daterange"
+	"go-challenge-financial-chat/internal/export"
+	"go-challenge-financial-chat/internal/models"
+	"log"
+	"os"
+)
+
+/*
+runExport implements "server export [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-format jsonl|csv|markdown] [-room NAME]
+[-o FILE]", writing the transcript to stdout unless -o is given. Dates are inclusive and in UTC
+*/
+func runExport(db *database.DB, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	firstDay := flags.String("from", "", "first day to export, YYYY-MM-DD")
+	lastDay := flags.String("to", "", "last day to export, YYYY-MM-DD")
+	formatName := flags.String("format", export.DefaultFormat, "jsonl, csv or markdown")
+	roomName := flags.String("room", "", "only export this room")
+	output := flags.String("o", "", "file to write, stdout when omitted")
+	flags.Parse(args)
+
+	format, err := export.Lookup(*formatName)
+	if err != nil {
+		return err
+	}
+
+	from, to, err := daterange.Parse(*firstDay, *lastDay)
+	if err != nil {
+		return err
+	}
+
+	filters := models.ExportFilters{From: from, To: to}
+	if *roomName != "" {
+		room, err := db.GetRoom(*roomName)
+		if err != nil {
+			return fmt.Errorf("room %q not found: %w", *roomName, err)
+		}
+		filters.RoomID = room.ID
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer out.Close()
+	}
+
+	writer := format.NewWriter(out)
+	exported := 0
+	err = db.ExportMessages(filters, func(msg models.ExportedMessage) error {
+		exported++
+		return writer.Write(msg)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	log.Printf("Exported %d messages", exported)
+	return nil
+}
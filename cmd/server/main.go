@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/joho/godotenv"
 	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/broker"
 	"go-challenge-financial-chat/internal/chat"
+	"go-challenge-financial-chat/internal/config"
 	"go-challenge-financial-chat/internal/database"
 	"go-challenge-financial-chat/internal/handlers"
 	"log"
@@ -17,17 +19,41 @@ func main() {
 		panic("Error loading env file")
 	}
 
-	db, err := database.New(getConnectionString())
+	db, err := database.Open(getConnectionString())
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer db.Close()
 
-	authService := auth.NewService(db)
-	brokers := os.Getenv("KAFKA_BROKERS")
-	hub := chat.NewHub(db, brokers)
+	if len(os.Args) > 1 {
+		err := runCommand(db, os.Args[1], os.Args[2:])
+		db.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := db.CheckSchema(); err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+
+	sessionSecret, err := config.SessionSecret()
+	if err != nil {
+		log.Fatal("Failed to load session secret:", err)
+	}
 
-	go hub.Run(brokers)
+	limits, err := config.RateLimits()
+	if err != nil {
+		log.Fatal("Invalid rate limits: ", err)
+	}
+
+	authService := auth.NewService(db, sessionSecret)
+	b := broker.NewKafka(os.Getenv("KAFKA_BROKERS"))
+	defer b.Close()
+
+	hub := chat.NewHub(db, b, limits)
+	go hub.Run()
 
 	h := handlers.New(authService, hub, db)
 	router := h.SetupRoutes()
@@ -37,11 +63,30 @@ func main() {
 	log.Fatal(http.ListenAndServe(port, router))
 }
 
+// getConnectionString returns DATABASE_URL when set, otherwise the MySQL DSN built from the DB_* settings
 func getConnectionString() string {
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		return dsn
+	}
+
 	dbUser := os.Getenv("DB_USER")
 	dbPass := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
-	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPass, dbHost, dbPort, dbName)
+	return fmt.Sprintf("mysql://%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPass, dbHost, dbPort, dbName)
+}
+
+// runCommand runs a subcommand of the server instead of serving
+func runCommand(db *database.DB, command string, args []string) error {
+	switch command {
+	case "migrate":
+		return runMigrate(db, args)
+	case "role":
+		return runRole(db, args)
+	case "export":
+		return runExport(db, args)
+	default:
+		return fmt.Errorf("unknown command %q, expected migrate, role or export", command)
+	}
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"go-challenge-financial-chat/internal/database"
+	"log"
+	"strconv"
+)
+
+/*
+runMigrate implements "server migrate up|down [N]|status"
+*/
+func runMigrate(db *database.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: server migrate up|down [N]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		if err := db.Migrate(); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		log.Println("Database schema is up to date")
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations to revert: %q", args[1])
+			}
+			steps = n
+		}
+		if err := db.MigrateDown(steps); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			return fmt.Errorf("failed to read migration status: %w", err)
+		}
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, state)
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/database"
+	"log"
+)
+
+/*
+runRole implements "server role USERNAME user|moderator|admin", used to appoint the first admin who can then manage
+the other users from the chat. Users already connected get the new role when they reconnect
+*/
+func runRole(db *database.DB, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: server role USERNAME user|moderator|admin")
+	}
+
+	username, role := args[0], args[1]
+	if !auth.ValidRole(role) {
+		return fmt.Errorf("unknown role %q, expected user, moderator or admin", role)
+	}
+
+	user, err := db.GetUser(username)
+	if err != nil {
+		return fmt.Errorf("user %q not found: %w", username, err)
+	}
+
+	if err := db.SetUserRole(user.ID, role); err != nil {
+		return fmt.Errorf("failed to change role: %w", err)
+	}
+	log.Printf("%s is now %s", username, role)
+	return nil
+}
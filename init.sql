@@ -1,19 +1,5 @@
 CREATE DATABASE IF NOT EXISTS chatdb;
 USE chatdb;
 
-CREATE TABLE IF NOT EXISTS users (
-                                     id INT AUTO_INCREMENT PRIMARY KEY,
-                                     username VARCHAR(50) UNIQUE NOT NULL,
-    password_hash VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-    );
-
-CREATE TABLE IF NOT EXISTS messages (
-                                        id INT AUTO_INCREMENT PRIMARY KEY,
-                                        user_id INT NOT NULL,
-                                        username VARCHAR(50) NOT NULL,
-    content TEXT NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id),
-    INDEX idx_created_at (created_at)
-    );
\ No newline at end of file
+-- Tables are created and upgraded by the versioned migrations in internal/database/migrations,
+-- run them with: go run cmd/server/main.go migrate up
@@ -1,19 +1,72 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"go-challenge-financial-chat/internal/database"
 	"go-challenge-financial-chat/internal/models"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
+const (
+	sessionCookie   = "session"
+	sessionDuration = 24 * time.Hour
+)
+
+var (
+	ErrInvalidSession = errors.New("invalid session")
+	ErrForbidden      = errors.New("forbidden")
+	ErrBanned         = errors.New("this account is banned")
+)
+
+// Permission is an action reserved to some roles
+type Permission string
+
+const (
+	// PermModerate allows keeping other users in line: muting, kicking and banning them
+	PermModerate Permission = "moderate"
+	// PermManageUsers allows changing the role of other users
+	PermManageUsers Permission = "manage_users"
+	// PermAdminister allows using the admin dashboard
+	PermAdminister Permission = "administer"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleUser:      {},
+	models.RoleModerator: {PermModerate},
+	models.RoleAdmin:     {PermModerate, PermManageUsers, PermAdminister},
+}
+
+// ValidRole reports whether role is one of the known user roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether the role grants the permission, the empty permission is granted to every role
+func Can(role string, permission Permission) bool {
+	return permission == "" || slices.Contains(rolePermissions[role], permission)
+}
+
 type Service struct {
-	db database.Database
+	db     database.Database
+	secret []byte
 }
 
-func NewService(db database.Database) *Service {
-	return &Service{db: db}
+// NewService creates the auth service, secret is the key used to sign session cookies
+func NewService(db database.Database, secret []byte) *Service {
+	return &Service{db: db, secret: secret}
 }
 
 func (s *Service) Register(username, password string) error {
@@ -40,33 +93,132 @@ func (s *Service) Login(username, password string) (*models.User, error) {
 		return nil, errors.New("invalid username or password")
 	}
 
+	if err := s.CheckBan(user.ID); err != nil {
+		if !errors.Is(err, ErrBanned) {
+			log.Printf("Error checking ban of %s: %v", user.Username, err)
+			return nil, errors.New("failed to log in, please try again")
+		}
+		return nil, err
+	}
+
 	return user, nil
 }
 
-func (s *Service) SetSession(w http.ResponseWriter, username string) {
+// CheckBan returns an error wrapping ErrBanned with the reason of the ban when the user is banned
+func (s *Service) CheckBan(userID int) error {
+	ban, err := s.db.GetBan(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrBanned, ban.Reason)
+}
+
+/*
+SetSession creates a new server-side session for the user and stores its signed ID in the session cookie
+*/
+func (s *Service) SetSession(w http.ResponseWriter, user *models.User) error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	session := &models.Session{
+		ID:        id,
+		UserID:    user.ID,
+		Username:  user.Username,
+		ExpiresAt: time.Now().UTC().Add(sessionDuration),
+	}
+	if err := s.db.CreateSession(session); err != nil {
+		return err
+	}
+
 	cookie := &http.Cookie{
-		Name:     "session",
-		Value:    username,
+		Name:     sessionCookie,
+		Value:    s.sign(id),
 		Path:     "/",
-		MaxAge:   3600 * 24,
+		MaxAge:   int(sessionDuration.Seconds()),
 		HttpOnly: true,
 		Secure:   false,
 		SameSite: http.SameSiteLaxMode,
 	}
 	http.SetCookie(w, cookie)
+	return nil
 }
 
-func (s *Service) GetSession(r *http.Request) (string, error) {
-	cookie, err := r.Cookie("session")
+/*
+GetSession verifies the session cookie signature and returns the matching session if it still exists and has not expired
+*/
+func (s *Service) GetSession(r *http.Request) (*models.Session, error) {
+	id, err := s.sessionID(r)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	session, err := s.db.GetSession(id)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		if err := s.db.DeleteSession(id); err != nil {
+			log.Printf("Error deleting expired session: %v", err)
+		}
+		return nil, ErrInvalidSession
+	}
+
+	return session, nil
+}
+
+/*
+Authorize returns the session of the request when its user's role grants the permission, ErrForbidden when it does not.
+The role is read with the session so role changes apply to the next request
+*/
+func (s *Service) Authorize(r *http.Request, permission Permission) (*models.Session, error) {
+	session, err := s.GetSession(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !Can(session.Role, permission) {
+		return nil, ErrForbidden
 	}
-	return cookie.Value, nil
+
+	return session, nil
+}
+
+// ClearSession revokes the current session on the server and removes the session cookie
+func (s *Service) ClearSession(w http.ResponseWriter, r *http.Request) {
+	if id, err := s.sessionID(r); err == nil {
+		if err := s.db.DeleteSession(id); err != nil {
+			log.Printf("Error deleting session: %v", err)
+		}
+	}
+
+	s.clearCookie(w)
+}
+
+// ClearAllSessions revokes every session of the current user, logging them out of all devices
+func (s *Service) ClearAllSessions(w http.ResponseWriter, r *http.Request) error {
+	session, err := s.GetSession(r)
+	if err != nil {
+		s.clearCookie(w)
+		return err
+	}
+
+	if err := s.db.DeleteUserSessions(session.UserID); err != nil {
+		return err
+	}
+
+	s.clearCookie(w)
+	return nil
 }
 
-func (s *Service) ClearSession(w http.ResponseWriter) {
+func (s *Service) clearCookie(w http.ResponseWriter) {
 	cookie := &http.Cookie{
-		Name:     "session",
+		Name:     sessionCookie,
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
@@ -74,3 +226,41 @@ func (s *Service) ClearSession(w http.ResponseWriter) {
 	}
 	http.SetCookie(w, cookie)
 }
+
+// sessionID extracts the session ID from the cookie, rejecting values with a missing or invalid signature
+func (s *Service) sessionID(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", err
+	}
+
+	id, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return "", ErrInvalidSession
+	}
+
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, s.mac(id)) {
+		return "", ErrInvalidSession
+	}
+
+	return id, nil
+}
+
+func (s *Service) sign(id string) string {
+	return id + "." + base64.RawURLEncoding.EncodeToString(s.mac(id))
+}
+
+func (s *Service) mac(id string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
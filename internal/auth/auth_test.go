@@ -1,11 +1,14 @@
 package auth
 
 import (
+	"database/sql"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -29,16 +32,181 @@ func (m *MockDB) GetUser(username string) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockDB) SaveMessage(userID int, username, content string) error {
-	args := m.Called(userID, username, content)
+func (m *MockDB) GetUsers() ([]models.User, error) {
+	args := m.Called()
+	return args.Get(0).([]models.User), args.Error(1)
+}
+
+func (m *MockDB) UpdateLastSeen(userID int, at time.Time) error {
+	args := m.Called(userID, at)
+	return args.Error(0)
+}
+
+func (m *MockDB) SetUserRole(userID int, role string) error {
+	args := m.Called(userID, role)
 	return args.Error(0)
 }
 
-func (m *MockDB) GetRecentMessages(limit int) ([]models.Message, error) {
+func (m *MockDB) BanUser(userID, bannedBy int, reason string) error {
+	args := m.Called(userID, bannedBy, reason)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetBan(userID int) (*models.Ban, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Ban), args.Error(1)
+}
+
+func (m *MockDB) GetBans() ([]models.Ban, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Ban), args.Error(1)
+}
+
+func (m *MockDB) UnbanUser(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockDB) CreateSession(session *models.Session) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetSession(id string) (*models.Session, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Session), args.Error(1)
+}
+
+func (m *MockDB) DeleteSession(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockDB) DeleteUserSessions(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetRoom(name string) (*models.Room, error) {
+	args := m.Called(name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Room), args.Error(1)
+}
+
+func (m *MockDB) GetRooms() ([]models.Room, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Room), args.Error(1)
+}
+
+func (m *MockDB) OpenDirectRoom(userID, peerID int) (*models.Room, error) {
+	args := m.Called(userID, peerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Room), args.Error(1)
+}
+
+func (m *MockDB) CanAccessRoom(roomID, userID int) (bool, error) {
+	args := m.Called(roomID, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDB) GetRoomMembers(roomID int) ([]string, error) {
+	args := m.Called(roomID)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockDB) GetConversations(userID int) ([]models.Conversation, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Conversation), args.Error(1)
+}
+
+func (m *MockDB) MarkRoomRead(roomID, userID, messageID int) error {
+	args := m.Called(roomID, userID, messageID)
+	return args.Error(0)
+}
+
+func (m *MockDB) SaveMessage(roomID, userID int, username, content string) (int, error) {
+	args := m.Called(roomID, userID, username, content)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDB) GetMessage(id int) (*models.Message, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Message), args.Error(1)
+}
+
+func (m *MockDB) EditMessage(id int, content string) error {
+	args := m.Called(id, content)
+	return args.Error(0)
+}
+
+func (m *MockDB) DeleteMessage(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetRecentMessages(roomID, before, limit int) ([]models.Message, error) {
+	args := m.Called(roomID, before, limit)
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+
+func (m *MockDB) GetLatestMessages(limit int) ([]models.Message, error) {
 	args := m.Called(limit)
 	return args.Get(0).([]models.Message), args.Error(1)
 }
 
+func (m *MockDB) SearchMessages(query string, filters models.SearchFilters) ([]models.Message, error) {
+	args := m.Called(query, filters)
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+
+func (m *MockDB) ExportMessages(filters models.ExportFilters, fn func(models.ExportedMessage) error) error {
+	args := m.Called(filters, fn)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetMessageVolume(since time.Time) ([]models.RoomVolume, error) {
+	args := m.Called(since)
+	return args.Get(0).([]models.RoomVolume), args.Error(1)
+}
+
+func (m *MockDB) SaveReply(roomID, parentID, userID int, username, content string) (int, error) {
+	args := m.Called(roomID, parentID, userID, username, content)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDB) GetThread(parentID int) ([]models.Message, error) {
+	args := m.Called(parentID)
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+
+func (m *MockDB) AddReaction(messageID, userID int, emoji string) error {
+	args := m.Called(messageID, userID, emoji)
+	return args.Error(0)
+}
+
+func (m *MockDB) RemoveReaction(messageID, userID int, emoji string) error {
+	args := m.Called(messageID, userID, emoji)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetReactions(messageID int) ([]models.Reaction, error) {
+	args := m.Called(messageID)
+	return args.Get(0).([]models.Reaction), args.Error(1)
+}
+
 func (m *MockDB) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -46,7 +214,7 @@ func (m *MockDB) Close() error {
 
 func TestService_Register(t *testing.T) {
 	mockDB := new(MockDB)
-	service := NewService(mockDB)
+	service := NewService(mockDB, []byte("test-secret"))
 
 	tests := []struct {
 		name          string
@@ -95,7 +263,7 @@ func TestService_Register(t *testing.T) {
 
 func TestService_Login(t *testing.T) {
 	mockDB := new(MockDB)
-	service := NewService(mockDB)
+	service := NewService(mockDB, []byte("test-secret"))
 
 	password := "password123"
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -104,6 +272,11 @@ func TestService_Login(t *testing.T) {
 		Username:     "testuser",
 		PasswordHash: string(hashedPassword),
 	}
+	bannedUser := &models.User{
+		ID:           2,
+		Username:     "banneduser",
+		PasswordHash: string(hashedPassword),
+	}
 
 	tests := []struct {
 		name          string
@@ -118,9 +291,20 @@ func TestService_Login(t *testing.T) {
 			password: password,
 			mockSetup: func() {
 				mockDB.On("GetUser", "testuser").Return(testUser, nil)
+				mockDB.On("GetBan", 1).Return(nil, sql.ErrNoRows)
 			},
 			expectedError: false,
 		},
+		{
+			name:     "Banned user",
+			username: "banneduser",
+			password: password,
+			mockSetup: func() {
+				mockDB.On("GetUser", "banneduser").Return(bannedUser, nil)
+				mockDB.On("GetBan", 2).Return(&models.Ban{UserID: 2, Reason: "spam"}, nil)
+			},
+			expectedError: true,
+		},
 		{
 			name:     "Invalid password",
 			username: "testuser",
@@ -159,43 +343,107 @@ func TestService_Login(t *testing.T) {
 
 func TestService_SessionManagement(t *testing.T) {
 	mockDB := new(MockDB)
-	service := NewService(mockDB)
+	service := NewService(mockDB, []byte("test-secret"))
+	testUser := &models.User{ID: 1, Username: "testuser"}
+
+	var sessionCookie *http.Cookie
+	var storedSession *models.Session
 
 	t.Run("SetSession", func(t *testing.T) {
+		mockDB.On("CreateSession", mock.AnythingOfType("*models.Session")).
+			Run(func(args mock.Arguments) {
+				storedSession = args.Get(0).(*models.Session)
+			}).
+			Return(nil).Once()
+
 		w := httptest.NewRecorder()
-		service.SetSession(w, "testuser")
+		err := service.SetSession(w, testUser)
+		assert.NoError(t, err)
 
 		cookies := w.Result().Cookies()
 		assert.Len(t, cookies, 1)
-		assert.Equal(t, "session", cookies[0].Name)
-		assert.Equal(t, "testuser", cookies[0].Value)
-		assert.Equal(t, 3600*24, cookies[0].MaxAge)
+		sessionCookie = cookies[0]
+		assert.Equal(t, "session", sessionCookie.Name)
+		assert.NotContains(t, sessionCookie.Value, "testuser")
+		assert.True(t, strings.HasPrefix(sessionCookie.Value, storedSession.ID+"."))
+		assert.Equal(t, 1, storedSession.UserID)
+		assert.Equal(t, 3600*24, sessionCookie.MaxAge)
 	})
 
 	t.Run("GetSession", func(t *testing.T) {
-		// Create a request with a session cookie
+		mockDB.On("GetSession", storedSession.ID).Return(storedSession, nil).Once()
+
 		req := httptest.NewRequest("GET", "/", nil)
-		cookie := &http.Cookie{
-			Name:  "session",
-			Value: "testuser",
-		}
-		req.AddCookie(cookie)
+		req.AddCookie(sessionCookie)
 
-		username, err := service.GetSession(req)
+		session, err := service.GetSession(req)
 		assert.NoError(t, err)
-		assert.Equal(t, "testuser", username)
+		assert.Equal(t, "testuser", session.Username)
+	})
+
+	t.Run("Authorize", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(sessionCookie)
+
+		user := *storedSession
+		user.Role = models.RoleUser
+		mockDB.On("GetSession", storedSession.ID).Return(&user, nil).Once()
+		session, err := service.Authorize(req, PermModerate)
+		assert.ErrorIs(t, err, ErrForbidden)
+		assert.Nil(t, session)
+
+		moderator := *storedSession
+		moderator.Role = models.RoleModerator
+		mockDB.On("GetSession", storedSession.ID).Return(&moderator, nil).Once()
+		session, err = service.Authorize(req, PermModerate)
+		assert.NoError(t, err)
+		assert.Equal(t, "testuser", session.Username)
+	})
+
+	t.Run("GetSession_TamperedCookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: "testuser"})
+
+		session, err := service.GetSession(req)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+		assert.Nil(t, session)
+
+		req = httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: storedSession.ID + ".forged"})
+
+		session, err = service.GetSession(req)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+		assert.Nil(t, session)
+	})
+
+	t.Run("GetSession_Expired", func(t *testing.T) {
+		expired := *storedSession
+		expired.ExpiresAt = time.Now().Add(-time.Minute)
+		mockDB.On("GetSession", storedSession.ID).Return(&expired, nil).Once()
+		mockDB.On("DeleteSession", storedSession.ID).Return(nil).Once()
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(sessionCookie)
+
+		session, err := service.GetSession(req)
+		assert.ErrorIs(t, err, ErrInvalidSession)
+		assert.Nil(t, session)
 	})
 
 	t.Run("GetSession_NoCookie", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/", nil)
-		username, err := service.GetSession(req)
+		session, err := service.GetSession(req)
 		assert.Error(t, err)
-		assert.Empty(t, username)
+		assert.Nil(t, session)
 	})
 
 	t.Run("ClearSession", func(t *testing.T) {
+		mockDB.On("DeleteSession", storedSession.ID).Return(nil).Once()
+
+		req := httptest.NewRequest("POST", "/logout", nil)
+		req.AddCookie(sessionCookie)
 		w := httptest.NewRecorder()
-		service.ClearSession(w)
+		service.ClearSession(w, req)
 
 		cookies := w.Result().Cookies()
 		assert.Len(t, cookies, 1)
@@ -203,4 +451,60 @@ func TestService_SessionManagement(t *testing.T) {
 		assert.Empty(t, cookies[0].Value)
 		assert.Equal(t, -1, cookies[0].MaxAge)
 	})
+
+	t.Run("ClearAllSessions", func(t *testing.T) {
+		mockDB.On("GetSession", storedSession.ID).Return(storedSession, nil).Once()
+		mockDB.On("DeleteUserSessions", 1).Return(nil).Once()
+
+		req := httptest.NewRequest("POST", "/logout-all", nil)
+		req.AddCookie(sessionCookie)
+		w := httptest.NewRecorder()
+		err := service.ClearAllSessions(w, req)
+		assert.NoError(t, err)
+	})
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission Permission
+		expected   bool
+	}{
+		{models.RoleUser, "", true},
+		{models.RoleUser, PermModerate, false},
+		{models.RoleUser, PermManageUsers, false},
+		{models.RoleModerator, PermModerate, true},
+		{models.RoleModerator, PermManageUsers, false},
+		{models.RoleModerator, PermAdminister, false},
+		{models.RoleAdmin, PermModerate, true},
+		{models.RoleAdmin, PermManageUsers, true},
+		{models.RoleAdmin, PermAdminister, true},
+		{"root", PermModerate, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+"/"+string(tt.permission), func(t *testing.T) {
+			assert.Equal(t, tt.expected, Can(tt.role, tt.permission))
+		})
+	}
+
+	assert.True(t, ValidRole(models.RoleModerator))
+	assert.False(t, ValidRole("root"))
+}
+
+func TestService_CheckBan(t *testing.T) {
+	mockDB := new(MockDB)
+	service := NewService(mockDB, []byte("test-secret"))
+
+	mockDB.On("GetBan", 1).Return(nil, sql.ErrNoRows)
+	assert.NoError(t, service.CheckBan(1))
+
+	mockDB.On("GetBan", 2).Return(&models.Ban{UserID: 2, Reason: "spam"}, nil)
+	err := service.CheckBan(2)
+	assert.ErrorIs(t, err, ErrBanned)
+	assert.Equal(t, "this account is banned: spam", err.Error())
+
+	mockDB.AssertExpectations(t)
 }
@@ -0,0 +1,48 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	TopicStockRequests = "stock-requests"
+	TopicStockQuotes   = "stock-quotes"
+)
+
+// ErrClosed is returned when publishing to or reading from a closed broker or subscription
+var ErrClosed = errors.New("broker closed")
+
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+/*
+Broker publishes messages to topics and hands them to subscribers, every consumer group of a topic
+receives each message once
+*/
+type Broker interface {
+	Publish(ctx context.Context, topic string, msg Message) error
+	Subscribe(topic, group string) Subscription
+	Close() error
+}
+
+// Subscription is a consumer of a topic within a consumer group
+type Subscription interface {
+	ReadMessage(ctx context.Context) (Message, error)
+	Health() SubscriptionHealth
+	Close() error
+}
+
+/*
+SubscriptionHealth tells how a subscription is reaching its brokers. Consumers retry failed connections and fetches
+on their own, so a consumer that can't reach the brokers shows up here rather than as ReadMessage errors
+*/
+type SubscriptionHealth struct {
+	Dials       int64     // connections opened to the brokers
+	Errors      int64     // failed connections and fetches, retried ones included
+	Lag         int64     // messages published but not read yet
+	LastFetchAt time.Time // zero until the first successful fetch
+}
@@ -0,0 +1,115 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"sync"
+	"time"
+)
+
+// kafkaStatsInterval is how often the stats of a subscription's reader are collected into its health
+const kafkaStatsInterval = 5 * time.Second
+
+type Kafka struct {
+	brokers []string
+	writer  *kafka.Writer
+}
+
+func NewKafka(brokers string) *Kafka {
+	return &Kafka{
+		brokers: []string{brokers},
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(brokers),
+			Balancer: &kafka.LeastBytes{},
+		},
+	}
+}
+
+func (k *Kafka) Publish(ctx context.Context, topic string, msg Message) error {
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Topic: topic,
+		Key:   msg.Key,
+		Value: msg.Value,
+	})
+}
+
+func (k *Kafka) Subscribe(topic, group string) Subscription {
+	s := &kafkaSubscription{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: k.brokers,
+			Topic:   topic,
+			GroupID: group,
+		}),
+		done: make(chan struct{}),
+	}
+	go s.collectStats()
+	return s
+}
+
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
+
+type kafkaSubscription struct {
+	reader *kafka.Reader
+	done   chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	health SubscriptionHealth
+}
+
+func (s *kafkaSubscription) ReadMessage(ctx context.Context) (Message, error) {
+	msg, err := s.reader.ReadMessage(ctx)
+	if errors.Is(err, io.EOF) {
+		return Message{}, ErrClosed
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Key: msg.Key, Value: msg.Value}, nil
+}
+
+func (s *kafkaSubscription) Health() SubscriptionHealth {
+	s.recordStats(s.reader.Stats(), time.Now())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+func (s *kafkaSubscription) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.reader.Close()
+}
+
+// collectStats records the reader's stats periodically, so the last fetch is known even when Health isn't called
+func (s *kafkaSubscription) collectStats() {
+	ticker := time.NewTicker(kafkaStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.recordStats(s.reader.Stats(), now)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// recordStats adds the reader's stats to the health, the reader's counters restart from zero every time they are read
+func (s *kafkaSubscription) recordStats(stats kafka.ReaderStats, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.health.Dials += stats.Dials
+	s.health.Errors += stats.Errors
+	s.health.Lag = stats.Lag
+	if stats.Fetches > 0 {
+		s.health.LastFetchAt = now
+	}
+}
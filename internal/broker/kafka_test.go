@@ -0,0 +1,25 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaSubscription_RecordStats(t *testing.T) {
+	s := &kafkaSubscription{}
+	start := time.Now()
+
+	s.recordStats(kafka.ReaderStats{Dials: 3, Errors: 3, Lag: -1}, start)
+	assert.Equal(t, SubscriptionHealth{Dials: 3, Errors: 3, Lag: -1}, s.health, "failing dials don't count as fetches")
+
+	s.recordStats(kafka.ReaderStats{Dials: 1, Fetches: 2, Lag: 4}, start.Add(time.Second))
+	assert.Equal(t, SubscriptionHealth{Dials: 4, Errors: 3, Lag: 4, LastFetchAt: start.Add(time.Second)}, s.health,
+		"the reader's counters restart from zero every time they are read")
+
+	s.recordStats(kafka.ReaderStats{Errors: 1}, start.Add(2*time.Second))
+	assert.Equal(t, start.Add(time.Second), s.health.LastFetchAt)
+	assert.Equal(t, int64(4), s.health.Errors)
+}
@@ -0,0 +1,117 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryQueueSize is the number of messages buffered per consumer group before Publish blocks
+const memoryQueueSize = 256
+
+/*
+Memory is an in-process broker for local development and tests. Messages published before a group
+subscribes to the topic are not delivered to that group
+*/
+type Memory struct {
+	mu     sync.Mutex
+	topics map[string]map[string]chan Message
+	done   chan struct{}
+	closed bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		topics: make(map[string]map[string]chan Message),
+		done:   make(chan struct{}),
+	}
+}
+
+func (m *Memory) Publish(ctx context.Context, topic string, msg Message) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	queues := make([]chan Message, 0, len(m.topics[topic]))
+	for _, queue := range m.topics[topic] {
+		queues = append(queues, queue)
+	}
+	m.mu.Unlock()
+
+	for _, queue := range queues {
+		select {
+		case queue <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.done:
+			return ErrClosed
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Subscribe(topic, group string) Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups, ok := m.topics[topic]
+	if !ok {
+		groups = make(map[string]chan Message)
+		m.topics[topic] = groups
+	}
+
+	queue, ok := groups[group]
+	if !ok {
+		queue = make(chan Message, memoryQueueSize)
+		groups[group] = queue
+	}
+
+	return &memorySubscription{
+		queue:  queue,
+		broker: m.done,
+		done:   make(chan struct{}),
+	}
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	return nil
+}
+
+type memorySubscription struct {
+	queue  chan Message
+	broker chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (s *memorySubscription) ReadMessage(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-s.queue:
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-s.broker:
+		return Message{}, ErrClosed
+	case <-s.done:
+		return Message{}, ErrClosed
+	}
+}
+
+// Health of an in-process subscription has nothing to reach, its lag is the number of messages waiting in its queue
+func (s *memorySubscription) Health() SubscriptionHealth {
+	return SubscriptionHealth{Lag: int64(len(s.queue)), LastFetchAt: time.Now()}
+}
+
+func (s *memorySubscription) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
@@ -0,0 +1,82 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_PublishSubscribe(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	first := b.Subscribe(TopicStockQuotes, "chat-app")
+	second := b.Subscribe(TopicStockQuotes, "audit")
+
+	err := b.Publish(ctx, TopicStockQuotes, Message{Key: []byte("aapl.us"), Value: []byte("quote")})
+	require.NoError(t, err)
+
+	for _, sub := range []Subscription{first, second} {
+		msg, err := sub.ReadMessage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "aapl.us", string(msg.Key))
+		assert.Equal(t, "quote", string(msg.Value))
+	}
+}
+
+func TestMemory_GroupSharesMessages(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	first := b.Subscribe(TopicStockRequests, "stock-bot")
+	second := b.Subscribe(TopicStockRequests, "stock-bot")
+
+	require.NoError(t, b.Publish(ctx, TopicStockRequests, Message{Value: []byte("one")}))
+	require.NoError(t, b.Publish(ctx, TopicStockRequests, Message{Value: []byte("two")}))
+
+	msg, err := first.ReadMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(msg.Value))
+
+	msg, err = second.ReadMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(msg.Value))
+}
+
+func TestMemory_Close(t *testing.T) {
+	b := NewMemory()
+	sub := b.Subscribe(TopicStockQuotes, "chat-app")
+
+	require.NoError(t, sub.Close())
+	_, err := sub.ReadMessage(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+
+	require.NoError(t, b.Close())
+	err = b.Publish(context.Background(), TopicStockQuotes, Message{})
+	assert.ErrorIs(t, err, ErrClosed)
+
+	_, err = b.Subscribe(TopicStockQuotes, "other").ReadMessage(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestMemory_Health(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+
+	sub := b.Subscribe(TopicStockQuotes, "chat-app")
+	require.NoError(t, b.Publish(context.Background(), TopicStockQuotes, Message{Value: []byte("quote")}))
+
+	health := sub.Health()
+	assert.Equal(t, int64(1), health.Lag)
+	assert.Zero(t, health.Errors)
+	assert.WithinDuration(t, time.Now(), health.LastFetchAt, time.Second, "an in-process broker is always reachable")
+}
@@ -0,0 +1,281 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/models"
+)
+
+/*
+Command is a slash command clients run from the message input. Its arguments are split on whitespace, the last one
+taking the rest of the line so free text such as a message can follow the fixed arguments
+*/
+type Command struct {
+	Name       string // name without the slash
+	Args       string // arguments as shown by /help, e.g. "username message"
+	Help       string
+	MinArgs    int
+	MaxArgs    int
+	Permission auth.Permission // permission needed to run the command, empty when everyone can
+	Bot        bool            // the command reaches the stock bot and counts against the stricter command rate limit
+	Posts      bool            // the command posts to a room, muted users can't run it
+	Run        func(c *Client, args []string) error
+}
+
+func (cmd *Command) usage() string {
+	return strings.TrimSpace("/" + cmd.Name + " " + cmd.Args)
+}
+
+// commandRegistry holds the commands by name, in registration order for /help
+type commandRegistry struct {
+	byName map[string]*Command
+	order  []*Command
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{byName: make(map[string]*Command)}
+}
+
+func (r *commandRegistry) register(cmd Command) {
+	if _, ok := r.byName[cmd.Name]; ok {
+		panic(fmt.Sprintf("command /%s registered twice", cmd.Name))
+	}
+	r.byName[cmd.Name] = &cmd
+	r.order = append(r.order, &cmd)
+}
+
+func (r *commandRegistry) lookup(name string) (*Command, bool) {
+	cmd, ok := r.byName[strings.ToLower(name)]
+	return cmd, ok
+}
+
+var commands = newCommandRegistry()
+
+func init() {
+	commands.register(Command{
+		Name:    "help",
+		Args:    "[command]",
+		Help:    "List the commands, or show how to use one",
+		MaxArgs: 1,
+		Run:     runHelp,
+	})
+	commands.register(Command{
+		Name:    "stock",
+		Args:    "SYMBOL",
+		Help:    "Post the quote of a stock to the room, e.g. /stock=aapl.us",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Bot:     true,
+		Posts:   true,
+		Run: func(c *Client, args []string) error {
+			c.hub.requestStock(c, args[0], false)
+			return nil
+		},
+	})
+	commands.register(Command{
+		Name:    "pstock",
+		Args:    "SYMBOL",
+		Help:    "Get the quote of a stock only you can see",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Bot:     true,
+		Run: func(c *Client, args []string) error {
+			c.hub.requestStock(c, args[0], true)
+			return nil
+		},
+	})
+	commands.register(Command{
+		Name:    "dm",
+		Args:    "username message",
+		Help:    "Send a direct message only that user can read",
+		MinArgs: 2,
+		MaxArgs: 2,
+		Posts:   true,
+		Run: func(c *Client, args []string) error {
+			return c.sendDM(args[0], args[1])
+		},
+	})
+	commands.register(Command{
+		Name: "who",
+		Help: "List who is in this room",
+		Run:  runWho,
+	})
+	commands.register(Command{
+		Name:    "me",
+		Args:    "action",
+		Help:    "Describe what you are doing, e.g. /me is buying AAPL",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Posts:   true,
+		Run: func(c *Client, args []string) error {
+			return c.postChat(models.WSMessage{
+				Type:     models.TypeChat,
+				Room:     c.room.Name,
+				Username: c.username,
+				Content:  "/me " + args[0],
+				Time:     time.Now(),
+			})
+		},
+	})
+	commands.register(Command{
+		Name:       "role",
+		Args:       "username user|moderator|admin",
+		Help:       "Change the role of a user",
+		MinArgs:    2,
+		MaxArgs:    2,
+		Permission: auth.PermManageUsers,
+		Run:        runRole,
+	})
+	commands.register(Command{
+		Name:       "mute",
+		Args:       "username [duration]",
+		Help:       "Stop a user from posting for a while, 10m by default",
+		MinArgs:    1,
+		MaxArgs:    2,
+		Permission: auth.PermModerate,
+		Run:        runMute,
+	})
+	commands.register(Command{
+		Name:       "unmute",
+		Args:       "username",
+		Help:       "Let a muted user post again",
+		MinArgs:    1,
+		MaxArgs:    1,
+		Permission: auth.PermModerate,
+		Run:        runUnmute,
+	})
+	commands.register(Command{
+		Name:       "kick",
+		Args:       "username",
+		Help:       "Disconnect a user, they can log back in",
+		MinArgs:    1,
+		MaxArgs:    1,
+		Permission: auth.PermModerate,
+		Run:        runKick,
+	})
+	commands.register(Command{
+		Name:       "ban",
+		Args:       "username reason",
+		Help:       "Disconnect a user and keep them from logging back in",
+		MinArgs:    2,
+		MaxArgs:    2,
+		Permission: auth.PermModerate,
+		Run:        runBan,
+	})
+	commands.register(Command{
+		Name:       "unban",
+		Args:       "username",
+		Help:       "Let a banned user log in again",
+		MinArgs:    1,
+		MaxArgs:    1,
+		Permission: auth.PermModerate,
+		Run:        runUnban,
+	})
+}
+
+/*
+parseCommand splits "/name arguments" into the command name and its arguments. "/name=argument" is accepted too so
+the original "/stock=aapl.us" syntax keeps working
+*/
+func parseCommand(content string) (name, rest string) {
+	content = strings.TrimPrefix(content, "/")
+	end := strings.IndexAny(content, " \t=")
+	if end < 0 {
+		return content, ""
+	}
+	return content[:end], strings.TrimSpace(content[end+1:])
+}
+
+// splitArgs splits the arguments on whitespace into at most n parts, the last part keeping the rest of the line
+func splitArgs(rest string, n int) []string {
+	var args []string
+	for rest != "" && len(args) < n-1 {
+		arg, remainder, _ := strings.Cut(rest, " ")
+		args = append(args, arg)
+		rest = strings.TrimSpace(remainder)
+	}
+	if rest != "" && n > 0 {
+		args = append(args, rest)
+	}
+	return args
+}
+
+// runCommand looks up the command of a command frame, checks its arguments and the user's permission and runs it
+func (c *Client) runCommand(content string) error {
+	name, rest := parseCommand(content)
+	cmd, ok := commands.lookup(name)
+	if !ok {
+		return fmt.Errorf("Unknown command /%s, type /help for the list of commands", name)
+	}
+
+	if !c.can(cmd.Permission) {
+		return fmt.Errorf("You are not allowed to use /%s", cmd.Name)
+	}
+
+	args := splitArgs(rest, cmd.MaxArgs)
+	if len(args) < cmd.MinArgs || (cmd.MaxArgs == 0 && rest != "") {
+		return fmt.Errorf("Usage: %s", cmd.usage())
+	}
+
+	return cmd.Run(c, args)
+}
+
+// notify sends a private system message to this client only
+func (c *Client) notify(content string) {
+	c.reply(models.WSMessage{
+		Type:    models.TypeSystem,
+		Room:    c.room.Name,
+		Content: content,
+		Private: true,
+		Time:    time.Now(),
+	})
+}
+
+func runHelp(c *Client, args []string) error {
+	if len(args) == 1 {
+		cmd, ok := commands.lookup(strings.TrimPrefix(args[0], "/"))
+		if !ok || !c.can(cmd.Permission) {
+			return fmt.Errorf("Unknown command /%s, type /help for the list of commands", strings.TrimPrefix(args[0], "/"))
+		}
+		c.notify(fmt.Sprintf("%s - %s", cmd.usage(), cmd.Help))
+		return nil
+	}
+
+	lines := []string{"Available commands:"}
+	for _, cmd := range commands.order {
+		if c.can(cmd.Permission) {
+			lines = append(lines, fmt.Sprintf("%s - %s", cmd.usage(), cmd.Help))
+		}
+	}
+	c.notify(strings.Join(lines, "\n"))
+	return nil
+}
+
+func runWho(c *Client, args []string) error {
+	var usernames []string
+	c.hub.inspect(func() {
+		for client := range c.hub.rooms[c.room.Name] {
+			usernames = append(usernames, client.username)
+		}
+	})
+
+	where := "this conversation"
+	if c.room.Kind != models.RoomDirect {
+		where = "#" + c.room.Name
+	}
+
+	slices.Sort(usernames)
+	c.notify(fmt.Sprintf("In %s: %s", where, strings.Join(slices.Compact(usernames), ", ")))
+	return nil
+}
+
+// isBotCommand reports whether the content runs a command that reaches the stock bot
+func isBotCommand(content string) bool {
+	name, _ := parseCommand(content)
+	cmd, ok := commands.lookup(name)
+	return ok && cmd.Bot
+}
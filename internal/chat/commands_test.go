@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		content string
+		name    string
+		rest    string
+	}{
+		{content: "/stock=aapl.us", name: "stock", rest: "aapl.us"},
+		{content: "/stock aapl.us", name: "stock", rest: "aapl.us"},
+		{content: "/dm  bob   hello there ", name: "dm", rest: "bob   hello there"},
+		{content: "/help", name: "help", rest: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			name, rest := parseCommand(tt.content)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.rest, rest)
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	assert.Equal(t, []string{"bob", "hello   there"}, splitArgs("bob  hello   there", 2))
+	assert.Equal(t, []string{"aapl.us"}, splitArgs("aapl.us", 1))
+	assert.Equal(t, []string{"bob"}, splitArgs("bob", 2))
+	assert.Nil(t, splitArgs("", 2))
+	assert.Nil(t, splitArgs("anything", 0))
+}
+
+func TestRunCommand_Errors(t *testing.T) {
+	client := &Client{username: "alice", role: models.RoleUser, room: &models.Room{Name: "general", Kind: models.RoomPublic}}
+
+	tests := []struct {
+		content string
+		error   string
+	}{
+		{content: "/shrug", error: "Unknown command /shrug, type /help for the list of commands"},
+		{content: "/stock", error: "Usage: /stock SYMBOL"},
+		{content: "/dm bob", error: "Usage: /dm username message"},
+		{content: "/who is there", error: "Usage: /who"},
+		{content: "/role bob admin", error: "You are not allowed to use /role"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			err := client.runCommand(tt.content)
+			require.Error(t, err)
+			assert.Equal(t, tt.error, err.Error())
+		})
+	}
+}
+
+func TestCommands(t *testing.T) {
+	for _, name := range []string{"help", "stock", "pstock", "dm", "who", "me", "role"} {
+		cmd, ok := commands.lookup(name)
+		require.True(t, ok, name)
+		assert.NotEmpty(t, cmd.Help, name)
+		assert.NotNil(t, cmd.Run, name)
+	}
+
+	assert.True(t, isBotCommand("/stock=aapl.us"))
+	assert.True(t, isBotCommand("/PSTOCK aapl.us"))
+	assert.False(t, isBotCommand("/dm bob hi"))
+	assert.False(t, isBotCommand("/nope"))
+}
+
+func TestClientRole(t *testing.T) {
+	client := &Client{username: "alice", role: models.RoleModerator}
+	assert.True(t, client.can(""))
+	assert.True(t, client.can(auth.PermModerate))
+	assert.False(t, client.can(auth.PermManageUsers))
+
+	client.setRole(models.RoleAdmin)
+	assert.True(t, client.can(auth.PermManageUsers))
+
+	err := client.runCommand("/role alice user")
+	require.Error(t, err)
+	assert.Equal(t, "You can't change your own role", err.Error())
+}
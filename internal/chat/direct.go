@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+// sendDM sends a direct message to another user, opening their conversation on first use
+func (c *Client) sendDM(to, content string) error {
+	if to == c.username {
+		return errors.New("You can't send a direct message to yourself")
+	}
+
+	peer, err := c.hub.db.GetUser(to)
+	if err != nil || peer.Username == models.BotUsername {
+		return errors.New("User not found")
+	}
+
+	room, err := c.hub.db.OpenDirectRoom(c.userID, peer.ID)
+	if err != nil {
+		log.Printf("Error opening direct room of %s and %s: %v", c.username, peer.Username, err)
+		return errors.New("Failed to send direct message")
+	}
+
+	return c.deliverDirect(room, peer.Username, content)
+}
+
+// sendDirectChat sends a chat message typed in a direct room to the other member of the room
+func (c *Client) sendDirectChat(content string) error {
+	members, err := c.hub.db.GetRoomMembers(c.room.ID)
+	if err != nil {
+		log.Printf("Error getting members of room %s: %v", c.room.Name, err)
+		return errors.New("Failed to send direct message")
+	}
+
+	for _, member := range members {
+		if member != c.username {
+			return c.deliverDirect(c.room, member, content)
+		}
+	}
+	return errors.New("User not found")
+}
+
+/*
+deliverDirect stores a direct message and routes it to every client of its sender and recipient, in whichever room
+they are, so other tabs can flag the conversation as unread
+*/
+func (c *Client) deliverDirect(room *models.Room, to, content string) error {
+	id, err := c.hub.db.SaveMessage(room.ID, c.userID, c.username, content)
+	if err != nil {
+		log.Printf("Error saving direct message: %v", err)
+		return errors.New("Failed to send direct message")
+	}
+
+	if err := c.hub.db.MarkRoomRead(room.ID, c.userID, id); err != nil {
+		log.Printf("Error marking room %s read: %v", room.Name, err)
+	}
+
+	c.hub.toUsers <- userMessage{
+		usernames: []string{c.username, to},
+		message: models.WSMessage{
+			Type:     models.TypeDM,
+			ID:       id,
+			Room:     room.Name,
+			Username: c.username,
+			To:       to,
+			Content:  content,
+			Time:     time.Now(),
+		},
+	}
+	return nil
+}
+
+/*
+markRead records that the user has seen the messages of the direct room up to id. Read markers aren't rate limited,
+so the ones that don't move this client's marker forward are dropped before reaching the database
+*/
+func (c *Client) markRead(id int) error {
+	if c.room.Kind != models.RoomDirect || id <= c.readUpTo {
+		return nil
+	}
+
+	if err := c.hub.db.MarkRoomRead(c.room.ID, c.userID, id); err != nil {
+		log.Printf("Error marking room %s read: %v", c.room.Name, err)
+		return errors.New("Failed to mark conversation as read")
+	}
+	c.readUpTo = id
+	return nil
+}
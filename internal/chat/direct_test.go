@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/broker"
+	"go-challenge-financial-chat/internal/models"
+)
+
+// newRunningHub starts a hub backed by an in-memory database and broker
+func newRunningHub(t *testing.T) *Hub {
+	b := broker.NewMemory()
+	t.Cleanup(func() { b.Close() })
+
+	hub := NewHub(newTestDB(t), b, DefaultRateLimits())
+	go hub.Run()
+	return hub
+}
+
+// connect registers the client with the hub and waits for its first history page
+func connect(t *testing.T, client *Client) {
+	client.hub.register <- client
+	_, ok := receive(client, models.TypeHistoryPage)
+	require.True(t, ok, "a connecting client gets the room's history")
+}
+
+// receive returns the next frame of the type sent to the client, skipping other frames, or false when none arrives shortly
+func receive(client *Client, frameType string) (models.WSMessage, bool) {
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case msg, ok := <-client.send:
+			if !ok {
+				return models.WSMessage{}, false
+			}
+			if msg.Type == frameType {
+				return msg, true
+			}
+		case <-timeout:
+			return models.WSMessage{}, false
+		}
+	}
+}
+
+func TestDirectMessages_Delivery(t *testing.T) {
+	hub := newRunningHub(t)
+	aliceGeneral := newTestClient(t, hub, "alice", "general")
+	aliceFX := newTestClient(t, hub, "alice", "fx")
+	bob := newTestClient(t, hub, "bob", "general")
+	carol := newTestClient(t, hub, "carol", "general")
+
+	for _, client := range []*Client{aliceGeneral, aliceFX, bob, carol} {
+		connect(t, client)
+	}
+
+	require.NoError(t, aliceGeneral.handleFrame(models.WSMessage{Type: models.TypeDM, To: "bob", Content: "Psst"}))
+
+	for name, client := range map[string]*Client{"alice in general": aliceGeneral, "alice in fx": aliceFX, "bob": bob} {
+		msg, ok := receive(client, models.TypeDM)
+		require.True(t, ok, "%s gets the direct message", name)
+		assert.Equal(t, "Psst", msg.Content)
+		assert.Equal(t, "alice", msg.Username)
+		assert.Equal(t, "bob", msg.To)
+	}
+
+	_, ok := receive(carol, models.TypeDM)
+	assert.False(t, ok, "other users don't get the direct message")
+
+	err := aliceGeneral.handleFrame(models.WSMessage{Type: models.TypeDM, To: models.BotUsername, Content: "Hi bot"})
+	assert.EqualError(t, err, "User not found", "nobody would answer a conversation with the bot")
+	conversations, err := hub.db.GetConversations(aliceGeneral.userID)
+	require.NoError(t, err)
+	require.Len(t, conversations, 1)
+	assert.Equal(t, "bob", conversations[0].Peer)
+}
@@ -1,20 +1,24 @@
 package chat
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/segmentio/kafka-go"
 	"log"
 	"net/http"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go-challenge-financial-chat/internal/broker"
 	"go-challenge-financial-chat/internal/database"
 	"go-challenge-financial-chat/internal/models"
 )
 
+// historyPageSize is the number of messages sent per page of room history
+const historyPageSize = 50
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
@@ -27,121 +31,243 @@ type Client struct {
 	send     chan models.WSMessage
 	username string
 	userID   int
+	room     *models.Room
+	typing   typingState
+
+	connectedAt time.Time
+
+	// role is read by readPump when running commands and changed by the hub when an admin changes it
+	roleMu sync.Mutex
+	role   string
+
+	// rate limiters, used only by readPump
+	chatLimit    *tokenBucket
+	commandLimit *tokenBucket
+	// readUpTo is the highest message ID this client marked read, used only by readPump
+	readUpTo int
 }
 
-type Hub struct {
-	clients     map[*Client]bool
-	broadcast   chan models.WSMessage
-	register    chan *Client
-	unregister  chan *Client
-	db          database.Database
-	kafkaWriter *kafka.Writer
+/*
+directMessage is a message addressed only to the clients of one user in the message room,
+or to a single client when client is set
+*/
+type directMessage struct {
+	username string
+	client   *Client
+	message  models.WSMessage
 }
 
-func NewHub(db database.Database, brokers string) *Hub {
-	kafkaWriter := &kafka.Writer{
-		Addr:     kafka.TCP(brokers),
-		Topic:    "stock-requests",
-		Balancer: &kafka.LeastBytes{},
+func (dm directMessage) addressedTo(client *Client) bool {
+	if dm.client != nil {
+		return client == dm.client
 	}
+	return client.username == dm.username
+}
+
+// userMessage is a message delivered to every client of the users, whatever room they are in
+type userMessage struct {
+	usernames []string
+	message   models.WSMessage
+}
 
+type Hub struct {
+	rooms      map[string]map[*Client]bool
+	users      map[string]map[*Client]bool
+	broadcast  chan models.WSMessage
+	direct     chan directMessage
+	toUsers    chan userMessage
+	inspector  chan func()
+	register   chan *Client
+	unregister chan *Client
+	db         database.Database
+	broker     broker.Broker
+	pendingMu  sync.Mutex
+	pending    map[string]*time.Timer
+	stockWait  time.Duration       // how long pending stock requests wait for the bot
+	botStats   BotStats            // guarded by pendingMu
+	quotes     broker.Subscription // guarded by pendingMu, set while listenForStockQuotes runs
+	limits     RateLimits
+	mutesMu    sync.Mutex
+	mutes      map[string]time.Time // muted usernames with when their mute ends
+}
+
+func NewHub(db database.Database, b broker.Broker, limits RateLimits) *Hub {
 	return &Hub{
-		clients:     make(map[*Client]bool),
-		broadcast:   make(chan models.WSMessage),
-		register:    make(chan *Client),
-		unregister:  make(chan *Client),
-		db:          db,
-		kafkaWriter: kafkaWriter,
+		rooms:      make(map[string]map[*Client]bool),
+		users:      make(map[string]map[*Client]bool),
+		broadcast:  make(chan models.WSMessage),
+		direct:     make(chan directMessage),
+		toUsers:    make(chan userMessage),
+		inspector:  make(chan func()),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		db:         db,
+		broker:     b,
+		pending:    make(map[string]*time.Timer),
+		stockWait:  stockRequestTimeout,
+		limits:     limits,
+		mutes:      make(map[string]time.Time),
 	}
 }
 
-func (h *Hub) Run(brokers string) {
-	go h.listenForStockQuotes(brokers)
+func (h *Hub) Run() {
+	go h.listenForStockQuotes()
 
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client] = true
-			log.Printf("Client %s connected", client.username)
+			members, ok := h.rooms[client.room.Name]
+			if !ok {
+				members = make(map[*Client]bool)
+				h.rooms[client.room.Name] = members
+			}
+			members[client] = true
+			if h.users[client.username] == nil {
+				h.users[client.username] = make(map[*Client]bool)
+				h.announcePresence(client, models.StatusOnline)
+			}
+			h.users[client.username][client] = true
+			log.Printf("Client %s connected to room %s", client.username, client.room.Name)
 
-			messages, err := h.db.GetRecentMessages(50)
+			page, err := h.historyPage(client.room, 0)
 			if err != nil {
 				log.Printf("Error getting recent messages: %v", err)
 			} else {
-				for _, msg := range messages {
-					wsMsg := models.WSMessage{
-						Type:     "message",
-						Username: msg.Username,
-						Content:  msg.Content,
-						Time:     msg.CreatedAt,
-					}
-					select {
-					case client.send <- wsMsg:
-					default:
-						close(client.send)
-						delete(h.clients, client)
-					}
+				select {
+				case client.send <- page:
+				default:
+					h.removeClient(client)
 				}
 			}
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				log.Printf("Client %s disconnected", client.username)
+			if h.rooms[client.room.Name][client] {
+				h.removeClient(client)
+				log.Printf("Client %s disconnected from room %s", client.username, client.room.Name)
 			}
 
 		case message := <-h.broadcast:
-			for client := range h.clients {
+			for client := range h.rooms[message.Room] {
 				select {
 				case client.send <- message:
 				default:
-					close(client.send)
-					delete(h.clients, client)
+					h.removeClient(client)
+				}
+			}
+
+		case dm := <-h.direct:
+			for client := range h.rooms[dm.message.Room] {
+				if !dm.addressedTo(client) {
+					continue
+				}
+				select {
+				case client.send <- dm.message:
+				default:
+					h.removeClient(client)
+				}
+			}
+
+		case um := <-h.toUsers:
+			for _, username := range slices.Compact(slices.Sorted(slices.Values(um.usernames))) {
+				for client := range h.users[username] {
+					select {
+					case client.send <- um.message:
+					default:
+						h.removeClient(client)
+					}
 				}
 			}
+
+		case f := <-h.inspector:
+			f()
 		}
 	}
 }
 
-func (h *Hub) listenForStockQuotes(brokers string) {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{brokers},
-		Topic:   "stock-quotes",
-		GroupID: "chat-app",
-	})
-	defer reader.Close()
+// inspect runs f on the Run goroutine so it can read the hub's client maps safely, f must not block
+func (h *Hub) inspect(f func()) {
+	done := make(chan struct{})
+	h.inspector <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
 
-	for {
-		msg, err := reader.ReadMessage(context.Background())
-		if err != nil {
-			log.Printf("Error reading from Kafka: %v", err)
-			time.Sleep(time.Second)
-			continue
+// OnlineUsers returns the usernames of the users with at least one connected client
+func (h *Hub) OnlineUsers() []string {
+	var online []string
+	h.inspect(func() {
+		for username := range h.users {
+			online = append(online, username)
 		}
+	})
 
-		var stockQuote models.StockQuote
-		if err := json.Unmarshal(msg.Value, &stockQuote); err != nil {
-			log.Printf("Error unmarshaling stock quote: %v", err)
-			continue
-		}
+	slices.Sort(online)
+	return online
+}
 
-		botMessage := models.WSMessage{
-			Type:     "message",
-			Username: "StockBot",
-			Content:  fmt.Sprintf("%s quote is $%.2f per share", stockQuote.Symbol, stockQuote.Price),
-			Time:     time.Now(),
+/*
+announcePresence tells every connected client that the user of client came online or went offline and records when
+the user was last seen. It is called from Run only when the first tab of a user connects or the last one disconnects
+*/
+func (h *Hub) announcePresence(client *Client, status string) {
+	now := time.Now()
+	go func() {
+		if err := h.db.UpdateLastSeen(client.userID, now); err != nil {
+			log.Printf("Error updating last seen of %s: %v", client.username, err)
 		}
+	}()
 
-		if err := h.db.SaveMessage(1, "StockBot", botMessage.Content); err != nil {
-			log.Printf("Error saving bot message: %v", err)
+	for _, clients := range h.users {
+		for other := range clients {
+			select {
+			case other.send <- models.WSMessage{Type: models.TypePresence, Room: other.room.Name, Username: client.username, Status: status, Time: now}:
+			default:
+				h.removeClient(other)
+			}
 		}
+	}
+}
+
+// historyPage loads the messages of the room sent before the given message ID as a history-page frame
+func (h *Hub) historyPage(room *models.Room, before int) (models.WSMessage, error) {
+	messages, err := h.db.GetRecentMessages(room.ID, before, historyPageSize)
+	if err != nil {
+		return models.WSMessage{}, err
+	}
+
+	return models.WSMessage{
+		Type:     models.TypeHistoryPage,
+		Room:     room.Name,
+		Before:   before,
+		Messages: messages,
+		HasMore:  len(messages) == historyPageSize,
+		Time:     time.Now(),
+	}, nil
+}
+
+// removeClient drops the client from its room and closes its send channel, it must only be called from Run
+func (h *Hub) removeClient(client *Client) {
+	members := h.rooms[client.room.Name]
+	if !members[client] {
+		return
+	}
+
+	delete(members, client)
+	close(client.send)
+	if len(members) == 0 {
+		delete(h.rooms, client.room.Name)
+	}
 
-		h.broadcast <- botMessage
+	delete(h.users[client.username], client)
+	if len(h.users[client.username]) == 0 {
+		delete(h.users, client.username)
+		h.announcePresence(client, models.StatusOffline)
 	}
 }
 
-func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, username string, userID int) {
+func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, username string, userID int, role string, room *models.Room) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -154,6 +280,13 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, username s
 		send:     make(chan models.WSMessage, 256),
 		username: username,
 		userID:   userID,
+		room:     room,
+		role:     role,
+
+		connectedAt: time.Now(),
+
+		chatLimit:    newTokenBucket(h.limits.ChatPerMinute, h.limits.ChatBurst),
+		commandLimit: newTokenBucket(h.limits.CommandPerMinute, h.limits.CommandBurst),
 	}
 
 	client.hub.register <- client
@@ -163,11 +296,12 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, username s
 }
 
 /*
-readPump reads incoming messages from the WebSocket connection and checks if should send message to Kafka
-or broadcasting it via the hub
+readPump reads incoming frames from the WebSocket connection, validates them against the protocol and checks if should
+send a command to the broker or broadcast the message via the hub
 */
 func (c *Client) readPump() {
 	defer func() {
+		c.stopTyping()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
@@ -179,9 +313,9 @@ func (c *Client) readPump() {
 		return nil
 	})
 
+	throttled := 0
 	for {
-		var wsMsg models.WSMessage
-		err := c.conn.ReadJSON(&wsMsg)
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -189,39 +323,62 @@ func (c *Client) readPump() {
 			break
 		}
 
-		wsMsg.Username = c.username
-		wsMsg.Time = time.Now()
+		var wsMsg models.WSMessage
+		invalid := json.Unmarshal(data, &wsMsg)
+		if invalid != nil {
+			wsMsg = models.WSMessage{}
+			invalid = errors.New("Malformed message")
+		} else {
+			invalid = validateIncoming(wsMsg)
+		}
 
-		if strings.HasPrefix(wsMsg.Content, "/stock=") {
-			stockCode := strings.TrimPrefix(wsMsg.Content, "/stock=")
-			stockRequest := map[string]string{
-				"stock_code": stockCode,
-				"user":       c.username,
+		// frames are charged before being rejected, so junk frames are throttled like any other
+		if !c.allowReceived(wsMsg, invalid, time.Now()) {
+			throttled++
+			if throttled >= floodDisconnectAfter {
+				log.Printf("Disconnecting %s from room %s for flooding", c.username, c.room.Name)
+				c.conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Too many messages"), time.Now().Add(time.Second))
+				break
 			}
+			c.reply(errorFrame(c.room.Name, wsMsg.Ref, "You are sending messages too fast, please slow down"))
+			continue
+		}
+		throttled = 0
 
-			reqBytes, _ := json.Marshal(stockRequest)
-			err := c.hub.kafkaWriter.WriteMessages(context.Background(),
-				kafka.Message{
-					Key:   []byte(stockCode),
-					Value: reqBytes,
-				},
-			)
+		if invalid != nil {
+			c.reply(errorFrame(c.room.Name, wsMsg.Ref, invalid.Error()))
+			continue
+		}
 
-			if err != nil {
-				log.Printf("Error sending to Kafka: %v", err)
+		if until, muted := c.hub.mutedUntil(c.username, time.Now()); muted && silenced(wsMsg) {
+			if wsMsg.Type != models.TypeTyping {
+				c.reply(errorFrame(c.room.Name, wsMsg.Ref, fmt.Sprintf("You are muted for another %s", formatDuration(time.Until(until)))))
 			}
-
 			continue
 		}
 
-		if err := c.hub.db.SaveMessage(c.userID, c.username, wsMsg.Content); err != nil {
-			log.Printf("Error saving message: %v", err)
+		ref := wsMsg.Ref
+		wsMsg.Room = c.room.Name
+		wsMsg.Username = c.username
+		wsMsg.Time = time.Now()
+
+		if err := c.handleFrame(wsMsg); err != nil {
+			c.reply(errorFrame(c.room.Name, ref, err.Error()))
+			continue
 		}
 
-		c.hub.broadcast <- wsMsg
+		if ref != "" && wsMsg.Type != models.TypeHistoryPage {
+			c.reply(ackFrame(c.room.Name, ref))
+		}
 	}
 }
 
+// reply sends a message to this client only
+func (c *Client) reply(message models.WSMessage) {
+	c.hub.direct <- directMessage{client: c, message: message}
+}
+
 /*
 writePump takes messages from the client.send channel and write them out to the WebSocket connection
 */
@@ -241,6 +398,7 @@ func (c *Client) writePump() {
 				return
 			}
 
+			message.Version = models.ProtocolVersion
 			if err := c.conn.WriteJSON(message); err != nil {
 				log.Printf("WebSocket write error: %v", err)
 				return
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestPresence_AcrossTabs(t *testing.T) {
+	hub := newRunningHub(t)
+	observer := newTestClient(t, hub, "bob", "general")
+	connect(t, observer)
+
+	first := newTestClient(t, hub, "alice", "general")
+	second := newTestClient(t, hub, "alice", "fx")
+
+	connect(t, first)
+	msg, ok := receive(observer, models.TypePresence)
+	require.True(t, ok, "the first tab brings the user online")
+	assert.Equal(t, "alice", msg.Username)
+	assert.Equal(t, models.StatusOnline, msg.Status)
+
+	connect(t, second)
+	_, ok = receive(observer, models.TypePresence)
+	assert.False(t, ok, "more tabs don't announce the user again")
+	assert.Equal(t, []string{"alice", "bob"}, hub.OnlineUsers())
+
+	hub.unregister <- first
+	_, ok = receive(observer, models.TypePresence)
+	assert.False(t, ok, "the user stays online while a tab is open")
+	assert.Equal(t, []string{"alice", "bob"}, hub.OnlineUsers())
+
+	hub.unregister <- second
+	msg, ok = receive(observer, models.TypePresence)
+	require.True(t, ok, "closing the last tab takes the user offline")
+	assert.Equal(t, "alice", msg.Username)
+	assert.Equal(t, models.StatusOffline, msg.Status)
+	assert.Equal(t, []string{"bob"}, hub.OnlineUsers())
+
+	hub.unregister <- second
+	_, ok = receive(observer, models.TypePresence)
+	assert.False(t, ok, "unregistering twice announces nothing")
+}
+
+func TestReadPump_JunkFramesDisconnect(t *testing.T) {
+	hub := newRunningHub(t)
+	client := newTestClient(t, hub, "alice", "general")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.HandleWebSocket(w, r, client.username, client.userID, client.role, client.room)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	for i := 0; i < DefaultRateLimits().ChatBurst+floodDisconnectAfter; i++ {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "junk frames are throttled until the client is disconnected: %v", err)
+}
+
+func TestBroadcast_StaysInRoom(t *testing.T) {
+	hub := newRunningHub(t)
+	alice := newTestClient(t, hub, "alice", "general")
+	bob := newTestClient(t, hub, "bob", "general")
+	carol := newTestClient(t, hub, "carol", "fx")
+	for _, client := range []*Client{alice, bob, carol} {
+		connect(t, client)
+	}
+
+	require.NoError(t, alice.handleFrame(models.WSMessage{Type: models.TypeChat, Room: "general", Username: "alice", Content: "Hello general"}))
+	for name, client := range map[string]*Client{"alice": alice, "bob": bob} {
+		msg, ok := receive(client, models.TypeChat)
+		require.True(t, ok, "%s gets the message of their room", name)
+		assert.Equal(t, "Hello general", msg.Content)
+		assert.Equal(t, "general", msg.Room)
+	}
+	_, ok := receive(carol, models.TypeChat)
+	assert.False(t, ok, "clients in other rooms don't get the message")
+
+	require.NoError(t, carol.handleFrame(models.WSMessage{Type: models.TypeChat, Room: "fx", Username: "carol", Content: "Hello fx"}))
+	msg, ok := receive(carol, models.TypeChat)
+	require.True(t, ok)
+	assert.Equal(t, "fx", msg.Room)
+	for _, client := range []*Client{alice, bob} {
+		_, ok := receive(client, models.TypeChat)
+		assert.False(t, ok, "%s is in another room", client.username)
+	}
+
+	fx, err := hub.db.GetRoom("fx")
+	require.NoError(t, err)
+	history, err := hub.db.GetRecentMessages(fx.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1, "messages are saved to their own room")
+	assert.Equal(t, "Hello fx", history[0].Content)
+}
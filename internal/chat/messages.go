@@ -0,0 +1,231 @@
+package chat
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+/*
+handleFrame acts on a validated frame received from the client, the returned error is sent back to the client
+*/
+func (c *Client) handleFrame(msg models.WSMessage) error {
+	switch msg.Type {
+	case models.TypeCommand:
+		return c.runCommand(strings.TrimSpace(msg.Content))
+
+	case models.TypeHistoryPage:
+		page, err := c.hub.historyPage(c.room, msg.Before)
+		if err != nil {
+			log.Printf("Error getting message history: %v", err)
+			return errors.New("Failed to load message history")
+		}
+		page.Ref = msg.Ref
+		c.reply(page)
+		return nil
+
+	case models.TypeTyping:
+		c.startTyping()
+		return nil
+
+	case models.TypeChat:
+		return c.postChat(msg)
+
+	case models.TypeDM:
+		return c.sendDM(msg.To, strings.TrimSpace(msg.Content))
+
+	case models.TypeRead:
+		return c.markRead(msg.ID)
+
+	case models.TypeReply:
+		return c.sendReply(msg)
+
+	case models.TypeEdit:
+		return c.editMessage(msg)
+
+	case models.TypeDelete:
+		return c.deleteMessage(msg)
+
+	case models.TypeReact, models.TypeUnreact:
+		return c.react(msg)
+	}
+
+	return errors.New("Unsupported message type")
+}
+
+// postChat sends a chat message typed by the user to the room, or to the other member of a direct room
+func (c *Client) postChat(msg models.WSMessage) error {
+	c.stopTyping()
+	if c.room.Kind == models.RoomDirect {
+		return c.sendDirectChat(msg.Content)
+	}
+	return c.sendChat(msg)
+}
+
+func (c *Client) sendChat(msg models.WSMessage) error {
+	id, err := c.hub.db.SaveMessage(c.room.ID, c.userID, c.username, msg.Content)
+	if err != nil {
+		log.Printf("Error saving message: %v", err)
+		return errors.New("Failed to save message")
+	}
+
+	msg.Ref = ""
+	msg.ID = id
+	c.hub.broadcast <- msg
+	return nil
+}
+
+// sendReply stores a reply to a top-level message of the room and broadcasts it with the parent's new reply count
+func (c *Client) sendReply(msg models.WSMessage) error {
+	parent, err := c.roomMessage(msg.ParentID)
+	if err != nil {
+		return err
+	}
+
+	if parent.ParentID != nil {
+		return errors.New("Replies can only be made to top-level messages")
+	}
+
+	id, err := c.hub.db.SaveReply(c.room.ID, parent.ID, c.userID, c.username, msg.Content)
+	if err != nil {
+		log.Printf("Error saving reply: %v", err)
+		return errors.New("Failed to save reply")
+	}
+
+	c.hub.broadcast <- models.WSMessage{
+		Type:       models.TypeReply,
+		ID:         id,
+		ParentID:   parent.ID,
+		Room:       c.room.Name,
+		Username:   c.username,
+		Content:    msg.Content,
+		Time:       msg.Time,
+		ReplyCount: parent.ReplyCount + 1,
+	}
+	return nil
+}
+
+func (c *Client) editMessage(msg models.WSMessage) error {
+	message, err := c.ownMessage(msg.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.hub.db.EditMessage(msg.ID, msg.Content); err != nil {
+		log.Printf("Error editing message %d: %v", msg.ID, err)
+		return errors.New("Failed to edit message")
+	}
+
+	editedAt := time.Now()
+	c.hub.broadcast <- models.WSMessage{
+		Type:     models.TypeEdit,
+		ID:       msg.ID,
+		ParentID: parentID(message),
+		Room:     c.room.Name,
+		Username: c.username,
+		Content:  msg.Content,
+		Time:     editedAt,
+		EditedAt: &editedAt,
+	}
+	return nil
+}
+
+func (c *Client) deleteMessage(msg models.WSMessage) error {
+	message, err := c.ownMessage(msg.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.hub.DeleteMessage(message, c.room.Name); err != nil {
+		log.Printf("Error deleting message %d: %v", msg.ID, err)
+		return errors.New("Failed to delete message")
+	}
+	return nil
+}
+
+// DeleteMessage deletes a message of the room and removes it from the screens of the room's clients
+func (h *Hub) DeleteMessage(message *models.Message, room string) error {
+	if err := h.db.DeleteMessage(message.ID); err != nil {
+		return err
+	}
+
+	h.broadcast <- models.WSMessage{
+		Type:     models.TypeDelete,
+		ID:       message.ID,
+		ParentID: parentID(message),
+		Room:     room,
+		Username: message.Username,
+		Time:     time.Now(),
+	}
+	return nil
+}
+
+// react adds or removes the user's reaction to a message and broadcasts the message's updated reactions
+func (c *Client) react(msg models.WSMessage) error {
+	message, err := c.roomMessage(msg.ID)
+	if err != nil {
+		return err
+	}
+
+	if msg.Type == models.TypeReact {
+		err = c.hub.db.AddReaction(msg.ID, c.userID, msg.Emoji)
+	} else {
+		err = c.hub.db.RemoveReaction(msg.ID, c.userID, msg.Emoji)
+	}
+	if err != nil {
+		log.Printf("Error updating reaction to message %d: %v", msg.ID, err)
+		return errors.New("Failed to update reaction")
+	}
+
+	reactions, err := c.hub.db.GetReactions(msg.ID)
+	if err != nil {
+		log.Printf("Error getting reactions to message %d: %v", msg.ID, err)
+		return errors.New("Failed to update reaction")
+	}
+
+	c.hub.broadcast <- models.WSMessage{
+		Type:      models.TypeReactions,
+		ID:        msg.ID,
+		ParentID:  parentID(message),
+		Room:      c.room.Name,
+		Username:  c.username,
+		Time:      time.Now(),
+		Reactions: reactions,
+	}
+	return nil
+}
+
+// roomMessage loads a live message of the client's room
+func (c *Client) roomMessage(id int) (*models.Message, error) {
+	message, err := c.hub.db.GetMessage(id)
+	if err != nil || message.RoomID != c.room.ID || message.DeletedAt != nil {
+		return nil, errors.New("Message not found")
+	}
+
+	return message, nil
+}
+
+// ownMessage loads a live message of the client's room and checks the client's user wrote it
+func (c *Client) ownMessage(id int) (*models.Message, error) {
+	message, err := c.roomMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.UserID != c.userID {
+		return nil, errors.New("You can only change your own messages")
+	}
+
+	return message, nil
+}
+
+// parentID returns the ID of the message a reply belongs to, zero for top-level messages
+func parentID(message *models.Message) int {
+	if message.ParentID == nil {
+		return 0
+	}
+	return *message.ParentID
+}
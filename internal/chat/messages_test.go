@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/database"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func newTestDB(t *testing.T) *database.DB {
+	db, err := database.Open("sqlite://:memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, db.Migrate())
+	return db
+}
+
+/*
+newTestClient returns a client of the user in the room, registering the user on first use. The client is not
+connected to the hub
+*/
+func newTestClient(t *testing.T, hub *Hub, username, room string) *Client {
+	user, err := hub.db.GetUser(username)
+	if err != nil {
+		require.NoError(t, hub.db.CreateUser(username, "hash"))
+		user, err = hub.db.GetUser(username)
+		require.NoError(t, err)
+	}
+
+	r, err := hub.db.GetRoom(room)
+	require.NoError(t, err)
+
+	return &Client{
+		hub:      hub,
+		send:     make(chan models.WSMessage, 16),
+		username: user.Username,
+		userID:   user.ID,
+		role:     user.Role,
+		room:     r,
+	}
+}
+
+// handleAsync runs handleFrame in the background, as the frames it accepts block on the hub's broadcast channel
+func handleAsync(c *Client, msg models.WSMessage) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- c.handleFrame(msg) }()
+	return done
+}
+
+func TestEditDelete_Ownership(t *testing.T) {
+	db := newTestDB(t)
+	hub := NewHub(db, nil, DefaultRateLimits())
+	alice := newTestClient(t, hub, "alice", "general")
+	bob := newTestClient(t, hub, "bob", "general")
+
+	id, err := db.SaveMessage(alice.room.ID, alice.userID, alice.username, "Original")
+	require.NoError(t, err)
+
+	err = bob.handleFrame(models.WSMessage{Type: models.TypeEdit, ID: id, Content: "Hijacked"})
+	assert.EqualError(t, err, "You can only change your own messages")
+	err = bob.handleFrame(models.WSMessage{Type: models.TypeDelete, ID: id})
+	assert.EqualError(t, err, "You can only change your own messages")
+	_, ok := nextBroadcast(hub)
+	assert.False(t, ok, "rejected changes are not broadcast")
+
+	message, err := db.GetMessage(id)
+	require.NoError(t, err)
+	assert.Equal(t, "Original", message.Content)
+	assert.Nil(t, message.DeletedAt)
+
+	elsewhere := newTestClient(t, hub, "carol", "fx")
+	elsewhere.userID = alice.userID
+	err = elsewhere.handleFrame(models.WSMessage{Type: models.TypeEdit, ID: id, Content: "Other room"})
+	assert.EqualError(t, err, "Message not found", "messages are changed from their own room")
+
+	done := handleAsync(alice, models.WSMessage{Type: models.TypeEdit, ID: id, Content: "Edited"})
+	msg, ok := nextBroadcast(hub)
+	require.True(t, ok)
+	require.NoError(t, <-done)
+	assert.Equal(t, models.TypeEdit, msg.Type)
+	assert.Equal(t, id, msg.ID)
+	assert.Equal(t, "general", msg.Room)
+	assert.Equal(t, "Edited", msg.Content)
+	assert.NotNil(t, msg.EditedAt)
+
+	done = handleAsync(alice, models.WSMessage{Type: models.TypeDelete, ID: id})
+	msg, ok = nextBroadcast(hub)
+	require.True(t, ok)
+	require.NoError(t, <-done)
+	assert.Equal(t, models.TypeDelete, msg.Type)
+	assert.Equal(t, id, msg.ID)
+
+	message, err = db.GetMessage(id)
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", message.Content)
+	assert.NotNil(t, message.DeletedAt)
+
+	err = alice.handleFrame(models.WSMessage{Type: models.TypeEdit, ID: id, Content: "Too late"})
+	assert.EqualError(t, err, "Message not found", "deleted messages can't be edited")
+	err = alice.handleFrame(models.WSMessage{Type: models.TypeDelete, ID: id})
+	assert.EqualError(t, err, "Message not found", "messages are deleted once")
+	_, ok = nextBroadcast(hub)
+	assert.False(t, ok)
+}
@@ -0,0 +1,236 @@
+package chat
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/models"
+)
+
+var ErrAlreadyBanned = errors.New("already banned")
+
+const (
+	defaultMute = 10 * time.Minute
+	maxMute     = 24 * time.Hour
+)
+
+// Announce sends a system message to every connected client, whatever room they are in
+func (h *Hub) Announce(content string) {
+	now := time.Now()
+	h.inspect(func() {
+		for _, clients := range h.users {
+			for client := range clients {
+				select {
+				case client.send <- models.WSMessage{Type: models.TypeSystem, Room: client.room.Name, Content: content, Time: now}:
+				default:
+					h.removeClient(client)
+				}
+			}
+		}
+	})
+}
+
+// disconnect closes every connection of the user after telling them why, returning how many were closed
+func (h *Hub) disconnect(username, reason string) int {
+	now := time.Now()
+	closed := 0
+	h.inspect(func() {
+		for client := range h.users[username] {
+			select {
+			case client.send <- models.WSMessage{Type: models.TypeSystem, Room: client.room.Name, Content: reason, Private: true, Time: now}:
+			default:
+			}
+			h.removeClient(client)
+			closed++
+		}
+	})
+	return closed
+}
+
+func (h *Hub) mute(username string, until time.Time) {
+	h.mutesMu.Lock()
+	defer h.mutesMu.Unlock()
+	h.mutes[username] = until
+}
+
+func (h *Hub) unmute(username string) bool {
+	h.mutesMu.Lock()
+	defer h.mutesMu.Unlock()
+	_, ok := h.mutes[username]
+	delete(h.mutes, username)
+	return ok
+}
+
+// mutedUntil reports whether the user is muted at now and until when, forgetting mutes that have run out
+func (h *Hub) mutedUntil(username string, now time.Time) (time.Time, bool) {
+	h.mutesMu.Lock()
+	defer h.mutesMu.Unlock()
+	until, ok := h.mutes[username]
+	if ok && !now.Before(until) {
+		delete(h.mutes, username)
+		return time.Time{}, false
+	}
+	return until, ok
+}
+
+/*
+silenced reports whether a muted user is barred from sending the frame. Muted users can still read history,
+delete their own messages and run the commands that don't post to a room
+*/
+func silenced(msg models.WSMessage) bool {
+	switch msg.Type {
+	case models.TypeHistoryPage, models.TypeRead, models.TypeDelete:
+		return false
+	case models.TypeCommand:
+		name, _ := parseCommand(msg.Content)
+		cmd, ok := commands.lookup(name)
+		return ok && cmd.Posts
+	}
+	return true
+}
+
+// moderationTarget loads the user a moderation command acts on, moderators and admins can't be moderated
+func (c *Client) moderationTarget(username string) (*models.User, error) {
+	if username == c.username {
+		return nil, errors.New("You can't moderate yourself")
+	}
+
+	user, err := c.hub.db.GetUser(username)
+	if err != nil || user.Username == models.BotUsername {
+		return nil, fmt.Errorf("User %s not found", username)
+	}
+
+	if auth.Can(user.Role, auth.PermModerate) {
+		return nil, fmt.Errorf("You can't moderate %s, change their role first", username)
+	}
+	return user, nil
+}
+
+func runMute(c *Client, args []string) error {
+	user, err := c.moderationTarget(args[0])
+	if err != nil {
+		return err
+	}
+
+	duration := defaultMute
+	if len(args) == 2 {
+		duration, err = time.ParseDuration(args[1])
+		if err != nil || duration <= 0 || duration > maxMute {
+			return fmt.Errorf("Invalid duration %s, expected e.g. 30s, 10m or 2h up to %s", args[1], formatDuration(maxMute))
+		}
+	}
+
+	c.hub.mute(user.Username, time.Now().Add(duration))
+	c.hub.Announce(fmt.Sprintf("%s was muted by %s for %s", user.Username, c.username, formatDuration(duration)))
+	return nil
+}
+
+// formatDuration writes a duration the way moderators type them, without zero minutes or seconds: 10m, 2h, 1h30m
+func formatDuration(d time.Duration) string {
+	text := d.Round(time.Second).String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+func runUnmute(c *Client, args []string) error {
+	if !c.hub.unmute(args[0]) {
+		return fmt.Errorf("%s is not muted", args[0])
+	}
+
+	c.hub.Announce(fmt.Sprintf("%s was unmuted by %s", args[0], c.username))
+	return nil
+}
+
+func runKick(c *Client, args []string) error {
+	user, err := c.moderationTarget(args[0])
+	if err != nil {
+		return err
+	}
+
+	if c.hub.disconnect(user.Username, fmt.Sprintf("You were kicked by %s", c.username)) == 0 {
+		return fmt.Errorf("%s is not connected", user.Username)
+	}
+
+	c.hub.Announce(fmt.Sprintf("%s was kicked by %s", user.Username, c.username))
+	return nil
+}
+
+func runBan(c *Client, args []string) error {
+	user, err := c.moderationTarget(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = c.hub.Ban(user, c.userID, c.username, args[1])
+	if errors.Is(err, ErrAlreadyBanned) {
+		return fmt.Errorf("%s is already banned", user.Username)
+	}
+	if err != nil {
+		log.Printf("Error banning %s: %v", user.Username, err)
+		return errors.New("Failed to ban user")
+	}
+	return nil
+}
+
+/*
+Ban keeps the user out of the chat: it stores the ban, revokes the user's sessions and closes their connections,
+announcing it to everyone. by is the moderator banning them
+*/
+func (h *Hub) Ban(user *models.User, byID int, by, reason string) error {
+	_, err := h.db.GetBan(user.ID)
+	if err == nil {
+		return ErrAlreadyBanned
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if err := h.db.BanUser(user.ID, byID, reason); err != nil {
+		return err
+	}
+
+	if err := h.db.DeleteUserSessions(user.ID); err != nil {
+		log.Printf("Error deleting sessions of %s: %v", user.Username, err)
+	}
+
+	h.disconnect(user.Username, fmt.Sprintf("You were banned by %s: %s", by, reason))
+	h.Announce(fmt.Sprintf("%s was banned by %s: %s", user.Username, by, reason))
+	return nil
+}
+
+func runUnban(c *Client, args []string) error {
+	user, err := c.hub.db.GetUser(args[0])
+	if err != nil {
+		return fmt.Errorf("User %s not found", args[0])
+	}
+
+	err = c.hub.Unban(user, c.username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s is not banned", user.Username)
+	}
+	if err != nil {
+		log.Printf("Error unbanning %s: %v", user.Username, err)
+		return errors.New("Failed to unban user")
+	}
+	return nil
+}
+
+// Unban lifts the ban of the user, announcing it to everyone. It returns sql.ErrNoRows when the user is not banned
+func (h *Hub) Unban(user *models.User, by string) error {
+	if err := h.db.UnbanUser(user.ID); err != nil {
+		return err
+	}
+
+	h.Announce(fmt.Sprintf("%s was unbanned by %s", user.Username, by))
+	return nil
+}
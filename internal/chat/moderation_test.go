@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestMute(t *testing.T) {
+	hub := NewHub(nil, nil, DefaultRateLimits())
+	now := time.Now()
+
+	_, muted := hub.mutedUntil("bob", now)
+	assert.False(t, muted)
+
+	hub.mute("bob", now.Add(time.Minute))
+	until, muted := hub.mutedUntil("bob", now)
+	assert.True(t, muted)
+	assert.Equal(t, now.Add(time.Minute), until)
+
+	_, muted = hub.mutedUntil("bob", now.Add(time.Minute))
+	assert.False(t, muted, "mutes end on time")
+	assert.False(t, hub.unmute("bob"), "ended mutes are forgotten")
+
+	hub.mute("bob", now.Add(time.Minute))
+	assert.True(t, hub.unmute("bob"))
+	_, muted = hub.mutedUntil("bob", now)
+	assert.False(t, muted)
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		30 * time.Second:                      "30s",
+		10 * time.Minute:                      "10m",
+		90 * time.Second:                      "1m30s",
+		2 * time.Hour:                         "2h",
+		90 * time.Minute:                      "1h30m",
+		time.Hour + 30*time.Second:            "1h0m30s",
+		10*time.Minute + 400*time.Millisecond: "10m",
+	}
+
+	for d, expected := range tests {
+		assert.Equal(t, expected, formatDuration(d), d.String())
+	}
+}
+
+func TestSilenced(t *testing.T) {
+	tests := []struct {
+		msg      models.WSMessage
+		expected bool
+	}{
+		{models.WSMessage{Type: models.TypeChat, Content: "hi"}, true},
+		{models.WSMessage{Type: models.TypeReply, Content: "hi"}, true},
+		{models.WSMessage{Type: models.TypeReact, Emoji: "👍"}, true},
+		{models.WSMessage{Type: models.TypeTyping}, true},
+		{models.WSMessage{Type: models.TypeCommand, Content: "/me waves"}, true},
+		{models.WSMessage{Type: models.TypeCommand, Content: "/stock=aapl.us"}, true},
+		{models.WSMessage{Type: models.TypeCommand, Content: "/pstock aapl.us"}, false},
+		{models.WSMessage{Type: models.TypeCommand, Content: "/help"}, false},
+		{models.WSMessage{Type: models.TypeHistoryPage}, false},
+		{models.WSMessage{Type: models.TypeDelete, ID: 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg.Type+" "+tt.msg.Content, func(t *testing.T) {
+			assert.Equal(t, tt.expected, silenced(tt.msg))
+		})
+	}
+}
+
+func TestModerationCommands_Permissions(t *testing.T) {
+	client := &Client{username: "alice", role: models.RoleUser, room: &models.Room{Name: "general"}}
+	for _, content := range []string{"/mute bob", "/unmute bob", "/kick bob", "/ban bob spam", "/unban bob"} {
+		err := client.runCommand(content)
+		require.Error(t, err, content)
+		assert.Contains(t, err.Error(), "You are not allowed to use", content)
+	}
+
+	client.setRole(models.RoleModerator)
+	err := client.runCommand("/kick alice")
+	require.Error(t, err)
+	assert.Equal(t, "You can't moderate yourself", err.Error())
+
+	err = client.runCommand("/ban bob")
+	require.Error(t, err)
+	assert.Equal(t, "Usage: /ban username reason", err.Error())
+}
+
+func TestModerationCommands_LiftingAnnounced(t *testing.T) {
+	hub := newRunningHub(t)
+	moderator := newTestClient(t, hub, "mod", "general")
+	moderator.setRole(models.RoleModerator)
+	observer := newTestClient(t, hub, "carol", "fx")
+	newTestClient(t, hub, "bob", "general")
+	connect(t, moderator)
+	connect(t, observer)
+
+	for _, tt := range []struct{ command, announcement string }{
+		{"/mute bob", "bob was muted by mod for 10m"},
+		{"/unmute bob", "bob was unmuted by mod"},
+		{"/ban bob spam", "bob was banned by mod: spam"},
+		{"/unban bob", "bob was unbanned by mod"},
+	} {
+		require.NoError(t, moderator.runCommand(tt.command), tt.command)
+		msg, ok := receive(observer, models.TypeSystem)
+		require.True(t, ok, tt.command)
+		assert.Equal(t, tt.announcement, msg.Content)
+		assert.False(t, msg.Private)
+	}
+
+	bob, err := hub.db.GetUser("bob")
+	require.NoError(t, err)
+	_, err = hub.db.GetBan(bob.ID)
+	assert.Error(t, err, "the ban is lifted")
+}
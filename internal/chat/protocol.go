@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+// clientTypes are the frame types a client is allowed to send, every other type is produced only by the server
+var clientTypes = map[string]bool{
+	models.TypeChat:        true,
+	models.TypeCommand:     true,
+	models.TypeHistoryPage: true,
+	models.TypeEdit:        true,
+	models.TypeDelete:      true,
+	models.TypeReply:       true,
+	models.TypeReact:       true,
+	models.TypeUnreact:     true,
+	models.TypeDM:          true,
+	models.TypeRead:        true,
+	models.TypeTyping:      true,
+}
+
+// maxEmojiLength is the maximum size in bytes of a reaction, enough for emoji made of several code points
+const maxEmojiLength = 32
+
+/*
+validateIncoming checks a frame received from a client against the protocol before the hub acts on it
+*/
+func validateIncoming(msg models.WSMessage) error {
+	if msg.Version != 0 && msg.Version != models.ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", msg.Version)
+	}
+
+	if !clientTypes[msg.Type] {
+		return fmt.Errorf("unsupported message type %q", msg.Type)
+	}
+
+	if msg.Type == models.TypeHistoryPage {
+		if msg.Before < 0 {
+			return errors.New("before must not be negative")
+		}
+		return nil
+	}
+
+	if (msg.Type == models.TypeEdit || msg.Type == models.TypeDelete || msg.Type == models.TypeRead) && msg.ID <= 0 {
+		return errors.New("id must reference a message")
+	}
+
+	if msg.Type == models.TypeReact || msg.Type == models.TypeUnreact {
+		if msg.ID <= 0 {
+			return errors.New("id must reference a message")
+		}
+		return validateEmoji(msg.Emoji)
+	}
+
+	if msg.Type == models.TypeReply && msg.ParentID <= 0 {
+		return errors.New("parent_id must reference a message")
+	}
+
+	if msg.Type == models.TypeDM && msg.To == "" {
+		return errors.New("to must name the recipient")
+	}
+
+	if msg.Type == models.TypeDelete || msg.Type == models.TypeRead || msg.Type == models.TypeTyping {
+		return nil
+	}
+
+	content := strings.TrimSpace(msg.Content)
+	if content == "" {
+		return errors.New("content must not be empty")
+	}
+
+	if msg.Type == models.TypeCommand && !strings.HasPrefix(content, "/") {
+		return errors.New("commands must start with /")
+	}
+
+	return nil
+}
+
+// validateEmoji accepts short non-ASCII strings so reactions can't be used to post text
+func validateEmoji(emoji string) error {
+	if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+		return errors.New("emoji must be a single emoji")
+	}
+
+	for _, r := range emoji {
+		if r < utf8.RuneSelf || unicode.IsSpace(r) {
+			return errors.New("emoji must be a single emoji")
+		}
+	}
+
+	return nil
+}
+
+// errorFrame builds the error sent back to a client in reply to the frame identified by ref
+func errorFrame(room, ref, content string) models.WSMessage {
+	return models.WSMessage{
+		Type:    models.TypeError,
+		Ref:     ref,
+		Room:    room,
+		Content: content,
+		Private: true,
+		Time:    time.Now(),
+	}
+}
+
+// ackFrame builds the acknowledgement of the client frame identified by ref
+func ackFrame(room, ref string) models.WSMessage {
+	return models.WSMessage{
+		Type: models.TypeAck,
+		Ref:  ref,
+		Room: room,
+		Time: time.Now(),
+	}
+}
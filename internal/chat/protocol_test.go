@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestValidateIncoming(t *testing.T) {
+	tests := []struct {
+		name          string
+		message       models.WSMessage
+		expectedError bool
+	}{
+		{
+			name:    "Chat message",
+			message: models.WSMessage{Version: models.ProtocolVersion, Type: models.TypeChat, Content: "hello"},
+		},
+		{
+			name:    "Chat message without version",
+			message: models.WSMessage{Type: models.TypeChat, Content: "hello"},
+		},
+		{
+			name:    "Command",
+			message: models.WSMessage{Type: models.TypeCommand, Content: "/stock=aapl.us"},
+		},
+		{
+			name:    "History page request",
+			message: models.WSMessage{Type: models.TypeHistoryPage, Before: 120},
+		},
+		{
+			name:          "History page with negative cursor",
+			message:       models.WSMessage{Type: models.TypeHistoryPage, Before: -1},
+			expectedError: true,
+		},
+		{
+			name:    "Edit",
+			message: models.WSMessage{Type: models.TypeEdit, ID: 7, Content: "fixed typo"},
+		},
+		{
+			name:          "Edit without content",
+			message:       models.WSMessage{Type: models.TypeEdit, ID: 7},
+			expectedError: true,
+		},
+		{
+			name:    "Delete",
+			message: models.WSMessage{Type: models.TypeDelete, ID: 7},
+		},
+		{
+			name:          "Delete without id",
+			message:       models.WSMessage{Type: models.TypeDelete},
+			expectedError: true,
+		},
+		{
+			name:    "Reply",
+			message: models.WSMessage{Type: models.TypeReply, ParentID: 3, Content: "agreed"},
+		},
+		{
+			name:          "Reply without parent",
+			message:       models.WSMessage{Type: models.TypeReply, Content: "agreed"},
+			expectedError: true,
+		},
+		{
+			name:    "React",
+			message: models.WSMessage{Type: models.TypeReact, ID: 3, Emoji: "👍"},
+		},
+		{
+			name:    "Unreact with multi code point emoji",
+			message: models.WSMessage{Type: models.TypeUnreact, ID: 3, Emoji: "👍🏽"},
+		},
+		{
+			name:          "React without message",
+			message:       models.WSMessage{Type: models.TypeReact, Emoji: "👍"},
+			expectedError: true,
+		},
+		{
+			name:          "React with text",
+			message:       models.WSMessage{Type: models.TypeReact, ID: 3, Emoji: "lol"},
+			expectedError: true,
+		},
+		{
+			name:          "React with empty emoji",
+			message:       models.WSMessage{Type: models.TypeReact, ID: 3},
+			expectedError: true,
+		},
+		{
+			name:    "Direct message",
+			message: models.WSMessage{Type: models.TypeDM, To: "bob", Content: "hi"},
+		},
+		{
+			name:          "Direct message without recipient",
+			message:       models.WSMessage{Type: models.TypeDM, Content: "hi"},
+			expectedError: true,
+		},
+		{
+			name:    "Read",
+			message: models.WSMessage{Type: models.TypeRead, ID: 7},
+		},
+		{
+			name:          "Read without message",
+			message:       models.WSMessage{Type: models.TypeRead},
+			expectedError: true,
+		},
+		{
+			name:    "Typing",
+			message: models.WSMessage{Type: models.TypeTyping},
+		},
+		{
+			name:          "Unsupported version",
+			message:       models.WSMessage{Version: 99, Type: models.TypeChat, Content: "hello"},
+			expectedError: true,
+		},
+		{
+			name:          "Server only type",
+			message:       models.WSMessage{Type: models.TypeSystem, Content: "hello"},
+			expectedError: true,
+		},
+		{
+			name:          "Unknown type",
+			message:       models.WSMessage{Type: "message", Content: "hello"},
+			expectedError: true,
+		},
+		{
+			name:          "Empty content",
+			message:       models.WSMessage{Type: models.TypeChat, Content: "   "},
+			expectedError: true,
+		},
+		{
+			name:          "Command without slash",
+			message:       models.WSMessage{Type: models.TypeCommand, Content: "stock=aapl.us"},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateIncoming(tt.message)
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"time"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+// floodDisconnectAfter is the number of consecutive throttled frames after which a client is disconnected
+const floodDisconnectAfter = 20
+
+/*
+RateLimits configures the token buckets of every client: a bucket holds up to Burst frames and refills at PerMinute
+frames per minute. Bot commands have their own bucket, usually stricter as each one reaches the broker and the quote
+provider. A zero PerMinute disables the limit
+*/
+type RateLimits struct {
+	ChatPerMinute    int
+	ChatBurst        int
+	CommandPerMinute int
+	CommandBurst     int
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		ChatPerMinute:    60,
+		ChatBurst:        10,
+		CommandPerMinute: 6,
+		CommandBurst:     3,
+	}
+}
+
+// tokenBucket is a rate limiter owned by the readPump of a single client, a nil bucket allows everything
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perMinute, burst int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+
+	return &tokenBucket{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(max(burst, 1)),
+		tokens: float64(max(burst, 1)),
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token from the bucket if one is available at the given time
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+/*
+allowFrame charges a frame to the bucket it counts against: bot commands to the command bucket, typing and read
+markers to none and everything else to the chat bucket. Read markers are cheap once markRead drops those that don't
+move forward
+*/
+func (c *Client) allowFrame(msg models.WSMessage, now time.Time) bool {
+	switch msg.Type {
+	case models.TypeTyping, models.TypeRead:
+		return true
+	case models.TypeCommand:
+		if isBotCommand(msg.Content) {
+			return c.commandLimit.allow(now)
+		}
+	}
+
+	return c.chatLimit.allow(now)
+}
+
+// allowReceived charges a received frame, frames that are malformed or fail validation count as chat whatever their type
+func (c *Client) allowReceived(msg models.WSMessage, invalid error, now time.Time) bool {
+	if invalid != nil {
+		return c.chatLimit.allow(now)
+	}
+	return c.allowFrame(msg, now)
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/database"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(60, 3)
+	now := bucket.last
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, bucket.allow(now), "burst frame %d", i)
+	}
+	assert.False(t, bucket.allow(now), "the bucket is empty")
+
+	assert.False(t, bucket.allow(now.Add(500*time.Millisecond)), "half a token has been refilled")
+	assert.True(t, bucket.allow(now.Add(1100*time.Millisecond)), "one token per second is refilled")
+
+	assert.True(t, bucket.allow(now.Add(time.Hour)))
+	assert.True(t, bucket.allow(now.Add(time.Hour)))
+	assert.True(t, bucket.allow(now.Add(time.Hour)))
+	assert.False(t, bucket.allow(now.Add(time.Hour)), "refills never exceed the burst")
+}
+
+func TestTokenBucket_Disabled(t *testing.T) {
+	bucket := newTokenBucket(0, 3)
+	assert.Nil(t, bucket)
+	for i := 0; i < 100; i++ {
+		assert.True(t, bucket.allow(time.Now()))
+	}
+}
+
+func TestAllowFrame(t *testing.T) {
+	client := &Client{
+		chatLimit:    newTokenBucket(60, 2),
+		commandLimit: newTokenBucket(6, 1),
+	}
+	now := time.Now()
+
+	assert.True(t, client.allowFrame(models.WSMessage{Type: models.TypeCommand, Content: "/stock=aapl.us"}, now))
+	assert.False(t, client.allowFrame(models.WSMessage{Type: models.TypeCommand, Content: "/stock=msft.us"}, now), "commands have their own bucket")
+
+	assert.True(t, client.allowFrame(models.WSMessage{Type: models.TypeChat, Content: "hi"}, now))
+	assert.True(t, client.allowFrame(models.WSMessage{Type: models.TypeCommand, Content: "/dm bob hi"}, now), "direct messages count as chat")
+	assert.False(t, client.allowFrame(models.WSMessage{Type: models.TypeChat, Content: "hi"}, now))
+
+	assert.True(t, client.allowFrame(models.WSMessage{Type: models.TypeTyping}, now), "typing is throttled separately")
+}
+
+func TestAllowReceived(t *testing.T) {
+	client := &Client{chatLimit: newTokenBucket(60, 2)}
+	now := time.Now()
+	typing := models.WSMessage{Type: models.TypeTyping}
+
+	assert.True(t, client.allowReceived(typing, errors.New("Malformed message"), now))
+	assert.True(t, client.allowReceived(typing, errors.New("Malformed message"), now))
+	assert.False(t, client.allowReceived(typing, errors.New("Malformed message"), now), "invalid frames count as chat")
+	assert.True(t, client.allowReceived(typing, nil, now), "valid typing frames are not charged")
+}
+
+// countingDB counts the read markers reaching the database
+type countingDB struct {
+	database.Database
+	marks int
+}
+
+func (db *countingDB) MarkRoomRead(roomID, userID, messageID int) error {
+	db.marks++
+	return db.Database.MarkRoomRead(roomID, userID, messageID)
+}
+
+func TestMarkRead_DropsStaleMarkers(t *testing.T) {
+	db := &countingDB{Database: newTestDB(t)}
+	hub := NewHub(db, nil, DefaultRateLimits())
+	alice := newTestClient(t, hub, "alice", "general")
+	bob := newTestClient(t, hub, "bob", "general")
+
+	room, err := db.OpenDirectRoom(alice.userID, bob.userID)
+	require.NoError(t, err)
+	alice.room = room
+
+	for _, id := range []int{5, 5, 3, 5} {
+		require.NoError(t, alice.handleFrame(models.WSMessage{Type: models.TypeRead, ID: id}))
+	}
+	assert.Equal(t, 1, db.marks, "reads that don't move the marker forward are dropped")
+
+	require.NoError(t, alice.handleFrame(models.WSMessage{Type: models.TypeRead, ID: 6}))
+	assert.Equal(t, 2, db.marks)
+
+	require.NoError(t, bob.handleFrame(models.WSMessage{Type: models.TypeRead, ID: 7}))
+	assert.Equal(t, 2, db.marks, "public rooms have no read marker")
+}
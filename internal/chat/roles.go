@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/models"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+/*
+SetRole stores the new role of the user and applies it to the user's connected clients right away, telling them
+about the change
+*/
+func (h *Hub) SetRole(user *models.User, role string) error {
+	if !auth.ValidRole(role) {
+		return ErrUnknownRole
+	}
+
+	if err := h.db.SetUserRole(user.ID, role); err != nil {
+		return err
+	}
+
+	h.inspect(func() {
+		for client := range h.users[user.Username] {
+			client.setRole(role)
+		}
+	})
+
+	h.toUsers <- userMessage{
+		usernames: []string{user.Username},
+		message: models.WSMessage{
+			Type:    models.TypeSystem,
+			Content: fmt.Sprintf("Your role is now %s", role),
+			Private: true,
+			Time:    time.Now(),
+		},
+	}
+	return nil
+}
+
+// can reports whether the client's user has the permission, the empty permission is granted to everyone
+func (c *Client) can(permission auth.Permission) bool {
+	c.roleMu.Lock()
+	defer c.roleMu.Unlock()
+	return auth.Can(c.role, permission)
+}
+
+func (c *Client) setRole(role string) {
+	c.roleMu.Lock()
+	defer c.roleMu.Unlock()
+	c.role = role
+}
+
+func runRole(c *Client, args []string) error {
+	username, role := args[0], args[1]
+	if username == c.username {
+		return errors.New("You can't change your own role")
+	}
+
+	user, err := c.hub.db.GetUser(username)
+	if err != nil || user.Username == models.BotUsername {
+		return fmt.Errorf("User %s not found", username)
+	}
+
+	if err := c.hub.SetRole(user, role); err != nil {
+		if errors.Is(err, ErrUnknownRole) {
+			return fmt.Errorf("Unknown role %s, expected %s, %s or %s", role, models.RoleUser, models.RoleModerator, models.RoleAdmin)
+		}
+		log.Printf("Error setting role of %s: %v", username, err)
+		return errors.New("Failed to change role")
+	}
+
+	c.notify(fmt.Sprintf("%s is now %s", username, role))
+	return nil
+}
@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"go-challenge-financial-chat/internal/broker"
+)
+
+// ClientInfo describes a connected client for the admin dashboard
+type ClientInfo struct {
+	Username    string
+	Room        string
+	ConnectedAt time.Time
+}
+
+// Clients lists the connected clients by username, a user has one client per open tab
+func (h *Hub) Clients() []ClientInfo {
+	var clients []ClientInfo
+	h.inspect(func() {
+		for _, members := range h.rooms {
+			for client := range members {
+				clients = append(clients, ClientInfo{
+					Username:    client.username,
+					Room:        client.room.Name,
+					ConnectedAt: client.connectedAt,
+				})
+			}
+		}
+	})
+
+	slices.SortFunc(clients, func(a, b ClientInfo) int {
+		if c := strings.Compare(a.Username, b.Username); c != 0 {
+			return c
+		}
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	return clients
+}
+
+// consumerStaleAfter is how long the quote consumer can go without a successful fetch before it is reported unreachable
+const consumerStaleAfter = 30 * time.Second
+
+/*
+BotStats counts the stock requests sent to the bot since the hub started and how they ended, and tracks the consumer
+reading the bot's quotes from the broker
+*/
+type BotStats struct {
+	Requested int
+	Quotes    int
+	Failed    int // answered with an error by the bot, or never published
+	TimedOut  int
+	Pending   int
+
+	ConsumerRunning   bool
+	ConsumerStartedAt time.Time
+	Consumer          broker.SubscriptionHealth
+	LastQuoteAt       time.Time
+	LastConsumerError string
+	LastErrorAt       time.Time
+}
+
+// BotStats returns a snapshot of the stock request counters and of the health of the quote consumer
+func (h *Hub) BotStats() BotStats {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	stats := h.botStats
+	stats.Pending = len(h.pending)
+	if h.quotes != nil {
+		stats.Consumer = h.quotes.Health()
+	}
+	return stats
+}
+
+/*
+ConsumerStatus sums up the quote consumer for the admin dashboard: "stopped", "unreachable" when it hasn't fetched
+from the broker for a while, or "running"
+*/
+func (s BotStats) ConsumerStatus(now time.Time) string {
+	if !s.ConsumerRunning {
+		return "stopped"
+	}
+
+	last := s.Consumer.LastFetchAt
+	if last.IsZero() {
+		last = s.ConsumerStartedAt
+	}
+	if now.Sub(last) > consumerStaleAfter {
+		return "unreachable"
+	}
+	return "running"
+}
+
+// recordBot updates the stock request counters
+func (h *Hub) recordBot(update func(stats *BotStats)) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+	update(&h.botStats)
+}
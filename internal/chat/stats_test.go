@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/broker"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestBotStats(t *testing.T) {
+	hub := NewHub(nil, nil, DefaultRateLimits())
+
+	hub.trackRequest(models.StockRequest{ID: "a", StockCode: "aapl.us"})
+	hub.trackRequest(models.StockRequest{ID: "b", StockCode: "msft.us"})
+	stats := hub.BotStats()
+	assert.Equal(t, 2, stats.Requested)
+	assert.Equal(t, 2, stats.Pending)
+
+	assert.True(t, hub.completeRequest("a"))
+	hub.recordBot(func(stats *BotStats) { stats.Quotes++ })
+	stats = hub.BotStats()
+	assert.Equal(t, 2, stats.Requested)
+	assert.Equal(t, 1, stats.Quotes)
+	assert.Equal(t, 1, stats.Pending)
+
+	hub.completeRequest("b")
+}
+
+func TestConsumerStatus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		stats    BotStats
+		expected string
+	}{
+		{"stopped", BotStats{}, "stopped"},
+		{"starting", BotStats{ConsumerRunning: true, ConsumerStartedAt: now.Add(-time.Second)}, "running"},
+		{"never fetched", BotStats{ConsumerRunning: true, ConsumerStartedAt: now.Add(-time.Minute)}, "unreachable"},
+		{"fetching", BotStats{ConsumerRunning: true, ConsumerStartedAt: now.Add(-time.Hour),
+			Consumer: broker.SubscriptionHealth{LastFetchAt: now.Add(-5 * time.Second)}}, "running"},
+		{"stalled", BotStats{ConsumerRunning: true, ConsumerStartedAt: now.Add(-time.Hour),
+			Consumer: broker.SubscriptionHealth{LastFetchAt: now.Add(-time.Minute)}}, "unreachable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.stats.ConsumerStatus(now))
+		})
+	}
+}
+
+func TestBotStats_ConsumerHealth(t *testing.T) {
+	hub := newRunningHub(t)
+	require.Eventually(t, func() bool { return hub.BotStats().ConsumerRunning }, time.Second, 10*time.Millisecond)
+
+	stats := hub.BotStats()
+	assert.Equal(t, "running", stats.ConsumerStatus(time.Now()))
+	assert.False(t, stats.Consumer.LastFetchAt.IsZero(), "the health comes from the subscription")
+}
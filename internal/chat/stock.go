@@ -0,0 +1,235 @@
+package chat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-challenge-financial-chat/internal/broker"
+	"go-challenge-financial-chat/internal/models"
+)
+
+// stockRequestTimeout is how long the hub waits for the bot before telling the requester the lookup timed out
+const stockRequestTimeout = 10 * time.Second
+
+/*
+requestStock publishes a stock request for the client to the broker and tracks it until the bot answers or the request times out
+*/
+func (h *Hub) requestStock(c *Client, stockCode string, private bool) {
+	request := models.StockRequest{
+		ID:          newRequestID(),
+		StockCode:   stockCode,
+		User:        c.username,
+		Room:        c.room.Name,
+		Private:     private,
+		RequestedAt: time.Now(),
+	}
+
+	h.trackRequest(request)
+	h.direct <- directMessage{
+		username: c.username,
+		message: models.WSMessage{
+			Type:      models.TypeSystem,
+			Room:      request.Room,
+			Username:  models.BotUsername,
+			Content:   fmt.Sprintf("Fetching quote for %s…", strings.ToUpper(stockCode)),
+			Private:   true,
+			RequestID: request.ID,
+			Time:      request.RequestedAt,
+		},
+	}
+
+	reqBytes, _ := json.Marshal(request)
+	err := h.broker.Publish(context.Background(), broker.TopicStockRequests,
+		broker.Message{
+			Key:   []byte(stockCode),
+			Value: reqBytes,
+		},
+	)
+
+	if err != nil {
+		log.Printf("Error publishing stock request: %v", err)
+		if h.completeRequest(request.ID) {
+			h.recordBot(func(stats *BotStats) { stats.Failed++ })
+			h.direct <- directMessage{
+				username: c.username,
+				message:  stockFailure(request, "The stock bot is unavailable, please try again later"),
+			}
+		}
+	}
+}
+
+// trackRequest registers a pending request and schedules its timeout notification
+func (h *Hub) trackRequest(request models.StockRequest) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	h.botStats.Requested++
+	h.pending[request.ID] = time.AfterFunc(h.stockWait, func() {
+		if !h.completeRequest(request.ID) {
+			return
+		}
+
+		log.Printf("Stock request %s for %s timed out", request.ID, request.StockCode)
+		h.recordBot(func(stats *BotStats) { stats.TimedOut++ })
+		h.direct <- directMessage{
+			username: request.User,
+			message:  stockFailure(request, fmt.Sprintf("Timed out waiting for a quote for %s", strings.ToUpper(request.StockCode))),
+		}
+	})
+}
+
+// completeRequest stops tracking a request, it returns false if the request was not pending anymore
+func (h *Hub) completeRequest(id string) bool {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	timer, ok := h.pending[id]
+	if !ok {
+		return false
+	}
+
+	timer.Stop()
+	delete(h.pending, id)
+	return true
+}
+
+func (h *Hub) listenForStockQuotes() {
+	sub := h.broker.Subscribe(broker.TopicStockQuotes, "chat-app")
+	defer sub.Close()
+
+	h.pendingMu.Lock()
+	h.quotes = sub
+	h.botStats.ConsumerRunning = true
+	h.botStats.ConsumerStartedAt = time.Now()
+	h.pendingMu.Unlock()
+	defer func() {
+		h.pendingMu.Lock()
+		h.quotes = nil
+		h.botStats.ConsumerRunning = false
+		h.pendingMu.Unlock()
+	}()
+
+	for {
+		msg, err := sub.ReadMessage(context.Background())
+		if errors.Is(err, broker.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading stock quotes: %v", err)
+			h.recordBot(func(stats *BotStats) {
+				stats.LastConsumerError = err.Error()
+				stats.LastErrorAt = time.Now()
+			})
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var response models.StockResponse
+		if err := json.Unmarshal(msg.Value, &response); err != nil {
+			log.Printf("Error unmarshaling stock response: %v", err)
+			continue
+		}
+
+		// the requester of a request that timed out was already told, and the timeout counted
+		if !h.completeRequest(response.RequestID) {
+			log.Printf("Dropping the late answer to stock request %s", response.RequestID)
+			continue
+		}
+
+		failed := response.Error != "" || response.Quote == nil
+		h.recordBot(func(stats *BotStats) {
+			if failed {
+				stats.Failed++
+				return
+			}
+			stats.Quotes++
+			stats.LastQuoteAt = time.Now()
+		})
+
+		if failed {
+			h.direct <- directMessage{
+				username: response.User,
+				message: models.WSMessage{
+					Type:      models.TypeError,
+					Room:      response.Room,
+					Username:  models.BotUsername,
+					Content:   stockErrorText(response),
+					Private:   true,
+					RequestID: response.RequestID,
+					Time:      time.Now(),
+				},
+			}
+			continue
+		}
+
+		botMessage := models.WSMessage{
+			Type:      models.TypeChat,
+			Room:      response.Room,
+			Username:  models.BotUsername,
+			Content:   fmt.Sprintf("%s quote is $%.2f per share", response.Quote.Symbol, response.Quote.Price),
+			Private:   response.Private,
+			RequestID: response.RequestID,
+			Time:      time.Now(),
+		}
+
+		if response.Private {
+			h.direct <- directMessage{username: response.User, message: botMessage}
+			continue
+		}
+
+		room, err := h.db.GetRoom(response.Room)
+		if err != nil {
+			log.Printf("Error getting room %q for stock quote: %v", response.Room, err)
+			continue
+		}
+
+		bot, err := h.db.GetUser(models.BotUsername)
+		if err != nil {
+			log.Printf("Error getting the bot user: %v", err)
+			continue
+		}
+
+		id, err := h.db.SaveMessage(room.ID, bot.ID, models.BotUsername, botMessage.Content)
+		if err != nil {
+			log.Printf("Error saving bot message: %v", err)
+		}
+		botMessage.ID = id
+
+		h.broadcast <- botMessage
+	}
+}
+
+// stockErrorText renders a failed stock response as a message for the requesting user
+func stockErrorText(response models.StockResponse) string {
+	symbol := strings.ToUpper(response.StockCode)
+	if response.Error == models.StockErrorNotFound {
+		return fmt.Sprintf("Could not find quote for %s", symbol)
+	}
+	return fmt.Sprintf("Could not fetch quote for %s right now, please try again later", symbol)
+}
+
+// stockFailure builds the error message sent to the requester when a request never reaches a response
+func stockFailure(request models.StockRequest, content string) models.WSMessage {
+	return models.WSMessage{
+		Type:      models.TypeError,
+		Room:      request.Room,
+		Username:  models.BotUsername,
+		Content:   content,
+		Private:   true,
+		RequestID: request.ID,
+		Time:      time.Now(),
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
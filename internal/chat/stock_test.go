@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/broker"
+	"go-challenge-financial-chat/internal/models"
+)
+
+// stockBot plays the stock bot against a running hub through an in-memory broker
+type stockBot struct {
+	t        *testing.T
+	broker   *broker.Memory
+	requests broker.Subscription
+}
+
+// newStockHub starts a hub whose stock requests time out after wait, with the bot that receives them
+func newStockHub(t *testing.T, wait time.Duration) (*Hub, *stockBot) {
+	b := broker.NewMemory()
+	t.Cleanup(func() { b.Close() })
+	bot := &stockBot{t: t, broker: b, requests: b.Subscribe(broker.TopicStockRequests, "stock-bot")}
+
+	hub := NewHub(newTestDB(t), b, DefaultRateLimits())
+	hub.stockWait = wait
+	go hub.Run()
+	require.Eventually(t, func() bool { return hub.BotStats().ConsumerRunning }, time.Second, 10*time.Millisecond,
+		"quotes published before the hub subscribes are lost")
+	return hub, bot
+}
+
+// next returns the next request the bot received
+func (b *stockBot) next() models.StockRequest {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := b.requests.ReadMessage(ctx)
+	require.NoError(b.t, err)
+	var request models.StockRequest
+	require.NoError(b.t, json.Unmarshal(msg.Value, &request))
+	return request
+}
+
+// answer publishes the quote of the request
+func (b *stockBot) answer(request models.StockRequest, price float64) {
+	response, err := json.Marshal(models.StockResponse{
+		RequestID: request.ID,
+		StockCode: request.StockCode,
+		User:      request.User,
+		Room:      request.Room,
+		Private:   request.Private,
+		Quote:     &models.StockQuote{Symbol: "AAPL.US", Price: price},
+	})
+	require.NoError(b.t, err)
+	require.NoError(b.t, b.broker.Publish(context.Background(), broker.TopicStockQuotes, broker.Message{Value: response}))
+}
+
+func TestStockRequest_Timeout(t *testing.T) {
+	hub, bot := newStockHub(t, 50*time.Millisecond)
+	alice := newTestClient(t, hub, "alice", "general")
+	bob := newTestClient(t, hub, "bob", "general")
+	connect(t, alice)
+	connect(t, bob)
+
+	require.NoError(t, alice.runCommand("/stock=aapl.us"))
+	request := bot.next()
+
+	fetching, ok := receive(alice, models.TypeSystem)
+	require.True(t, ok, "the requester is told the quote is on its way")
+	assert.Equal(t, "Fetching quote for AAPL.US…", fetching.Content)
+	assert.Equal(t, request.ID, fetching.RequestID)
+
+	timedOut, ok := receive(alice, models.TypeError)
+	require.True(t, ok, "the requester is told the request timed out")
+	assert.Equal(t, "Timed out waiting for a quote for AAPL.US", timedOut.Content)
+	assert.Equal(t, request.ID, timedOut.RequestID)
+	assert.True(t, timedOut.Private)
+	_, ok = receive(bob, models.TypeError)
+	assert.False(t, ok, "only the requester hears of the timeout")
+
+	bot.answer(request, 250)
+	for _, frameType := range []string{models.TypeError, models.TypeChat} {
+		_, ok = receive(alice, frameType)
+		assert.False(t, ok, "a late answer sends no %s frame", frameType)
+	}
+	_, ok = receive(bob, models.TypeChat)
+	assert.False(t, ok, "a late quote isn't posted to the room")
+
+	stats := hub.BotStats()
+	assert.Equal(t, 1, stats.TimedOut)
+	assert.Zero(t, stats.Quotes)
+	assert.Zero(t, stats.Pending)
+}
+
+func TestStockRequest_Private(t *testing.T) {
+	hub, bot := newStockHub(t, time.Second)
+	alice := newTestClient(t, hub, "alice", "general")
+	aliceFX := newTestClient(t, hub, "alice", "fx")
+	bob := newTestClient(t, hub, "bob", "general")
+	for _, client := range []*Client{alice, aliceFX, bob} {
+		connect(t, client)
+	}
+
+	require.NoError(t, alice.runCommand("/pstock aapl.us"))
+	request := bot.next()
+	assert.True(t, request.Private)
+	bot.answer(request, 250)
+
+	quote, ok := receive(alice, models.TypeChat)
+	require.True(t, ok, "the requester gets the quote")
+	assert.Equal(t, "AAPL.US quote is $250.00 per share", quote.Content)
+	assert.True(t, quote.Private)
+	assert.Zero(t, quote.ID, "private quotes aren't saved")
+
+	_, ok = receive(bob, models.TypeChat)
+	assert.False(t, ok, "other users in the room don't get private quotes")
+	_, ok = receive(aliceFX, models.TypeChat)
+	assert.False(t, ok, "the requester's tabs in other rooms don't get the quote")
+
+	general, err := hub.db.GetRoom("general")
+	require.NoError(t, err)
+	history, err := hub.db.GetRecentMessages(general.ID, 0, 50)
+	require.NoError(t, err)
+	assert.Empty(t, history, "private quotes stay out of the room's history")
+	assert.Equal(t, 1, hub.BotStats().Quotes)
+}
@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"sync"
+	"time"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+const (
+	// typingThrottle is the minimum interval between two typing frames of a client relayed to its room
+	typingThrottle = 2 * time.Second
+	// typingTimeout is how long a client is shown as typing after its last typing frame
+	typingTimeout = 5 * time.Second
+)
+
+// typingState throttles the typing frames of a client and expires them when the client stops sending them
+type typingState struct {
+	mu       sync.Mutex
+	lastSent time.Time
+	timer    *time.Timer
+}
+
+/*
+startTyping relays to the room that the client is typing, at most once per typingThrottle, and (re)arms the timer
+that tells the room the client stopped. Typing frames are never persisted
+*/
+func (c *Client) startTyping() {
+	c.typing.mu.Lock()
+	defer c.typing.mu.Unlock()
+
+	if c.typing.timer == nil {
+		c.typing.timer = time.AfterFunc(typingTimeout, c.stopTyping)
+	} else {
+		c.typing.timer.Reset(typingTimeout)
+	}
+
+	now := time.Now()
+	if now.Sub(c.typing.lastSent) < typingThrottle {
+		return
+	}
+	c.typing.lastSent = now
+	c.hub.broadcast <- c.typingFrame(models.TypingStarted)
+}
+
+// stopTyping tells the room the client is no longer typing, it does nothing when the client was not typing
+func (c *Client) stopTyping() {
+	c.typing.mu.Lock()
+	defer c.typing.mu.Unlock()
+
+	if c.typing.timer == nil {
+		return
+	}
+	c.typing.timer.Stop()
+	c.typing.timer = nil
+	c.typing.lastSent = time.Time{}
+	c.hub.broadcast <- c.typingFrame(models.TypingStopped)
+}
+
+func (c *Client) typingFrame(status string) models.WSMessage {
+	return models.WSMessage{
+		Type:     models.TypeTyping,
+		Room:     c.room.Name,
+		Username: c.username,
+		Status:   status,
+		Time:     time.Now(),
+	}
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/models"
+)
+
+// nextBroadcast returns the next message sent to the hub, or false when none arrives shortly
+func nextBroadcast(hub *Hub) (models.WSMessage, bool) {
+	select {
+	case msg := <-hub.broadcast:
+		return msg, true
+	case <-time.After(100 * time.Millisecond):
+		return models.WSMessage{}, false
+	}
+}
+
+func TestTyping(t *testing.T) {
+	hub := NewHub(nil, nil, DefaultRateLimits())
+	client := &Client{hub: hub, username: "alice", room: &models.Room{Name: "general"}}
+
+	go client.startTyping()
+	msg, ok := nextBroadcast(hub)
+	require.True(t, ok)
+	assert.Equal(t, models.TypeTyping, msg.Type)
+	assert.Equal(t, models.TypingStarted, msg.Status)
+	assert.Equal(t, "alice", msg.Username)
+
+	go client.startTyping()
+	_, ok = nextBroadcast(hub)
+	assert.False(t, ok, "typing frames within the throttle interval are dropped")
+
+	go client.stopTyping()
+	msg, ok = nextBroadcast(hub)
+	require.True(t, ok)
+	assert.Equal(t, models.TypingStopped, msg.Status)
+
+	go client.stopTyping()
+	_, ok = nextBroadcast(hub)
+	assert.False(t, ok, "a client that is not typing can't stop")
+
+	go client.startTyping()
+	msg, ok = nextBroadcast(hub)
+	require.True(t, ok, "stopping resets the throttle")
+	assert.Equal(t, models.TypingStarted, msg.Status)
+
+	go client.stopTyping()
+	_, ok = nextBroadcast(hub)
+	assert.True(t, ok)
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"go-challenge-financial-chat/internal/chat"
+)
+
+// RateLimits returns the default per-client rate limits overridden by the *_RATE_* settings
+func RateLimits() (chat.RateLimits, error) {
+	limits := chat.DefaultRateLimits()
+	for _, setting := range []struct {
+		key   string
+		value *int
+	}{
+		{"CHAT_RATE_PER_MINUTE", &limits.ChatPerMinute},
+		{"CHAT_RATE_BURST", &limits.ChatBurst},
+		{"COMMAND_RATE_PER_MINUTE", &limits.CommandPerMinute},
+		{"COMMAND_RATE_BURST", &limits.CommandBurst},
+	} {
+		if text := os.Getenv(setting.key); text != "" {
+			n, err := strconv.Atoi(text)
+			if err != nil || n < 0 {
+				return chat.RateLimits{}, fmt.Errorf("invalid %s %q, expected a non-negative integer", setting.key, text)
+			}
+			*setting.value = n
+		}
+	}
+	return limits, nil
+}
+
+// SessionSecret returns the key signing session cookies, a random one when SESSION_SECRET is not set
+func SessionSecret() ([]byte, error) {
+	secret := os.Getenv("SESSION_SECRET")
+	if secret != "" {
+		return []byte(secret), nil
+	}
+
+	log.Println("SESSION_SECRET is not set, using a random secret: sessions will not survive a restart")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generating session secret: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/chat"
+)
+
+func TestRateLimits(t *testing.T) {
+	limits, err := RateLimits()
+	require.NoError(t, err)
+	assert.Equal(t, chat.DefaultRateLimits(), limits)
+
+	t.Setenv("CHAT_RATE_BURST", "3")
+	t.Setenv("COMMAND_RATE_PER_MINUTE", "0")
+	limits, err = RateLimits()
+	require.NoError(t, err)
+	assert.Equal(t, 3, limits.ChatBurst)
+	assert.Equal(t, 0, limits.CommandPerMinute)
+	assert.Equal(t, chat.DefaultRateLimits().ChatPerMinute, limits.ChatPerMinute)
+
+	t.Setenv("CHAT_RATE_PER_MINUTE", "-1")
+	_, err = RateLimits()
+	assert.ErrorContains(t, err, "CHAT_RATE_PER_MINUTE")
+}
+
+func TestSessionSecret(t *testing.T) {
+	t.Setenv("SESSION_SECRET", "")
+	first, err := SessionSecret()
+	require.NoError(t, err)
+	assert.Len(t, first, 32)
+	second, err := SessionSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "a random secret is generated when none is set")
+
+	t.Setenv("SESSION_SECRET", "configured")
+	secret, err := SessionSecret()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("configured"), secret)
+}
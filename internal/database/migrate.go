@@ -0,0 +1,370 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaOutOfDate is returned by CheckSchema when migrations are pending
+var ErrSchemaOutOfDate = errors.New("database schema is out of date, run the migrate command")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration and whether it has been applied to the database
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+/*
+loadMigrations reads the embedded migrations of a dialect, files are named VERSION_NAME.up.sql and VERSION_NAME.down.sql
+*/
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+
+		versionText, migrationName, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q", name)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (db *DB) ensureMigrationsTable() error {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+                  version INT PRIMARY KEY,
+                  name VARCHAR(255) NOT NULL,
+                  applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+              )`
+	_, err := db.conn.Exec(query)
+	return err
+}
+
+// appliedVersions reads the applied migrations without writing to the database, none when schema_migrations is missing
+func (db *DB) appliedVersions() (map[int]bool, error) {
+	applied := make(map[int]bool)
+	exists, err := db.hasTable("schema_migrations")
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := db.conn.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every known migration in order and whether it has been applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Migration: m, Applied: applied[m.Version]}
+	}
+
+	return status, nil
+}
+
+// Migrate applies every pending migration in version order
+func (db *DB) Migrate() error {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return err
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range status {
+		if m.Applied {
+			continue
+		}
+
+		if m.Version == baselineVersion {
+			if err := db.setAsideBaseline(); err != nil {
+				return fmt.Errorf("adopting the baseline schema: %w", err)
+			}
+		}
+
+		log.Printf("Applying migration %04d_%s", m.Version, m.Name)
+		if err := db.execScript(m.Up); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+
+		if m.Version == baselineVersion {
+			if err := db.restoreBaseline(); err != nil {
+				return fmt.Errorf("adopting the baseline schema: %w", err)
+			}
+		}
+
+		if _, err := db.conn.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+func (db *DB) MigrateDown(steps int) error {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for i := len(status) - 1; i >= 0 && steps > 0; i-- {
+		m := status[i]
+		if !m.Applied {
+			continue
+		}
+
+		log.Printf("Reverting migration %04d_%s", m.Version, m.Name)
+		if err := db.execScript(m.Down); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+
+		if _, err := db.conn.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+			return err
+		}
+		steps--
+	}
+
+	return nil
+}
+
+/*
+CheckSchema returns ErrSchemaOutOfDate unless every known migration has been applied. It only reads the database,
+so the server can run with a user that can't change the schema
+*/
+func (db *DB) CheckSchema() error {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range status {
+		if !m.Applied {
+			return ErrSchemaOutOfDate
+		}
+	}
+
+	return nil
+}
+
+/*
+baselineVersion is the migration creating the tables. Databases created by the init.sql that predates migrations
+already have users and a messages table without rooms, which its CREATE TABLE IF NOT EXISTS statements would keep
+*/
+const baselineVersion = 1
+
+// baselineMessagesTable holds the messages of a baseline database while the baseline migration creates the current table
+const baselineMessagesTable = "baseline_messages"
+
+// botPasswordHash is the password hash the baseline migration gives the stock bot
+const botPasswordHash = "!"
+
+/*
+setAsideBaseline renames the messages table of a baseline database out of the way of the baseline migration. It
+refuses to run when a user took the bot's name, as they would become the bot
+*/
+func (db *DB) setAsideBaseline() error {
+	exists, err := db.hasTable("messages")
+	if err != nil || !exists {
+		return err
+	}
+
+	current, err := db.hasColumn("messages", "room_id")
+	if err != nil || current {
+		return err
+	}
+
+	var hash string
+	err = db.conn.QueryRow("SELECT password_hash FROM users WHERE username = ?", models.BotUsername).Scan(&hash)
+	if err == nil && hash != botPasswordHash {
+		return fmt.Errorf("user %s already exists, rename it so the stock bot can take the name", models.BotUsername)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	log.Printf("Adopting the baseline schema, messages are moved to the general room")
+	_, err = db.conn.Exec("ALTER TABLE messages RENAME TO " + baselineMessagesTable)
+	return err
+}
+
+/*
+restoreBaseline copies the messages set aside by setAsideBaseline into the table created by the baseline migration,
+keeping their IDs. Baseline messages were all posted to the general room, and the bot's as whoever had user ID 1
+*/
+func (db *DB) restoreBaseline() error {
+	exists, err := db.hasTable(baselineMessagesTable)
+	if err != nil || !exists {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO messages (id, room_id, user_id, username, content, created_at)
+              SELECT m.id, r.id, COALESCE(bot.id, m.user_id), m.username, m.content, m.created_at
+              FROM ` + baselineMessagesTable + ` m
+              JOIN rooms r ON r.name = 'general'
+              LEFT JOIN users bot ON bot.username = m.username AND bot.username = ?
+              ORDER BY m.id ASC`
+	if _, err := tx.Exec(query, models.BotUsername); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DROP TABLE " + baselineMessagesTable); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) hasTable(table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if db.dialect == "mysql" {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	}
+
+	var count int
+	err := db.conn.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
+
+func (db *DB) hasColumn(table, column string) (bool, error) {
+	query := "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+	if db.dialect == "mysql" {
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+	}
+
+	var count int
+	err := db.conn.QueryRow(query, table, column).Scan(&count)
+	return count > 0, err
+}
+
+/*
+execScript runs the statements of a migration one by one in a transaction. MySQL commits DDL statements implicitly,
+so a failing MySQL migration may be left partially applied
+*/
+func (db *DB) execScript(script string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a SQL script on the semicolons ending its statements, dropping comment lines
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
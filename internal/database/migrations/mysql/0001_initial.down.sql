@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP FOREIGN KEY fk_messages_parent;
+DROP INDEX idx_parent_id ON messages;
+ALTER TABLE messages DROP COLUMN parent_id;
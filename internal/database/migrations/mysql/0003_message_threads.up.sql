@@ -0,0 +1,3 @@
+ALTER TABLE messages ADD COLUMN parent_id INT NULL DEFAULT NULL AFTER user_id;
+ALTER TABLE messages ADD CONSTRAINT fk_messages_parent FOREIGN KEY (parent_id) REFERENCES messages(id);
+CREATE INDEX idx_parent_id ON messages (parent_id);
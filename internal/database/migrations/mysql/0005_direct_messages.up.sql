@@ -0,0 +1,13 @@
+-- Direct message conversations are rooms of kind 'direct' that only their members can access
+ALTER TABLE rooms ADD COLUMN kind VARCHAR(10) NOT NULL DEFAULT 'public' AFTER name;
+
+CREATE TABLE IF NOT EXISTS room_members (
+    room_id INT NOT NULL,
+    user_id INT NOT NULL,
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id)
+);
@@ -0,0 +1,9 @@
+-- Banned users can neither log in nor connect until they are unbanned
+CREATE TABLE IF NOT EXISTS bans (
+    user_id INT PRIMARY KEY,
+    reason VARCHAR(255) NOT NULL,
+    banned_by INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (banned_by) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE messages DROP INDEX idx_content;
@@ -0,0 +1,2 @@
+-- Full-text index used by message search, see DB.SearchMessages
+ALTER TABLE messages ADD FULLTEXT INDEX idx_content (content);
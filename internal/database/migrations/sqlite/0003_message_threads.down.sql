@@ -0,0 +1,2 @@
+DROP INDEX idx_messages_parent_id;
+ALTER TABLE messages DROP COLUMN parent_id;
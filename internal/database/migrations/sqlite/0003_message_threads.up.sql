@@ -0,0 +1,2 @@
+ALTER TABLE messages ADD COLUMN parent_id INTEGER NULL REFERENCES messages(id);
+CREATE INDEX idx_messages_parent_id ON messages (parent_id);
@@ -0,0 +1,6 @@
+-- Direct rooms would become public once kind is gone, so they are deleted with their messages, replies first
+DELETE FROM messages WHERE parent_id IS NOT NULL AND room_id IN (SELECT id FROM rooms WHERE kind = 'direct');
+DELETE FROM messages WHERE room_id IN (SELECT id FROM rooms WHERE kind = 'direct');
+DELETE FROM rooms WHERE kind = 'direct';
+DROP TABLE IF EXISTS room_members;
+ALTER TABLE rooms DROP COLUMN kind;
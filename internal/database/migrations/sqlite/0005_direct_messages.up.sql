@@ -0,0 +1,12 @@
+-- Direct message conversations are rooms of kind 'direct' that only their members can access
+ALTER TABLE rooms ADD COLUMN kind VARCHAR(10) NOT NULL DEFAULT 'public';
+
+CREATE TABLE IF NOT EXISTS room_members (
+    room_id INTEGER NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_members_user_id ON room_members (user_id);
@@ -0,0 +1,2 @@
+-- Roles are user, moderator or admin, see auth.Can for what each one allows
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
@@ -0,0 +1,7 @@
+-- Banned users can neither log in nor connect until they are unbanned
+CREATE TABLE IF NOT EXISTS bans (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(255) NOT NULL,
+    banned_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
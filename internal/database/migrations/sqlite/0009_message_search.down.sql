@@ -0,0 +1 @@
+-- Nothing to revert, see 0009_message_search.up.sql
@@ -0,0 +1 @@
+-- SQLite searches messages with LIKE, there is no full-text index to create
@@ -0,0 +1,37 @@
+// Package daterange parses the inclusive day ranges given to searches and exports
+package daterange
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Layout is how the first and last days of a range are given, dates are in UTC
+const Layout = time.DateOnly
+
+/*
+Parse parses the optional first and last days of a range, empty ones leave their end open. The last day is inclusive,
+so the returned end is the start of the next day
+*/
+func Parse(first, last string) (from, to time.Time, err error) {
+	if first != "" {
+		from, err = time.Parse(Layout, first)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", first)
+		}
+	}
+
+	if last != "" {
+		to, err = time.Parse(Layout, last)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", last)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("invalid date range, from is after to")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,28 @@
+package daterange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	from, to, err := Parse("", "")
+	require.NoError(t, err)
+	assert.True(t, from.IsZero())
+	assert.True(t, to.IsZero())
+
+	from, to, err = Parse("2026-03-01", "2026-03-01")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), to, "the last day is included")
+
+	_, _, err = Parse("03/01/2026", "")
+	assert.EqualError(t, err, `invalid from date "03/01/2026", expected YYYY-MM-DD`)
+	_, _, err = Parse("", "tomorrow")
+	assert.EqualError(t, err, `invalid to date "tomorrow", expected YYYY-MM-DD`)
+	_, _, err = Parse("2026-03-02", "2026-03-01")
+	assert.EqualError(t, err, "invalid date range, from is after to")
+}
@@ -0,0 +1,186 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format, expected jsonl, csv or markdown")
+
+const DefaultFormat = "jsonl"
+
+// Writer writes the messages of an export one at a time, nothing is guaranteed to reach the output before Flush
+type Writer interface {
+	Write(msg models.ExportedMessage) error
+	Flush() error
+}
+
+// Format is an export format with how its files are served and named
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	newWriter   func(w io.Writer) Writer
+}
+
+var formats = []Format{
+	{Name: "jsonl", ContentType: "application/x-ndjson", Extension: "jsonl", newWriter: newJSONLines},
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv", newWriter: newCSV},
+	{Name: "markdown", ContentType: "text/markdown; charset=utf-8", Extension: "md", newWriter: newMarkdown},
+}
+
+// Lookup returns the format with the name, the default format when the name is empty
+func Lookup(name string) (Format, error) {
+	if name == "" {
+		name = DefaultFormat
+	}
+	for _, format := range formats {
+		if format.Name == name {
+			return format, nil
+		}
+	}
+	return Format{}, ErrUnknownFormat
+}
+
+func (f Format) NewWriter(w io.Writer) Writer {
+	return f.newWriter(w)
+}
+
+// jsonLines writes one JSON object per message and line
+type jsonLines struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLines(w io.Writer) Writer {
+	buf := bufio.NewWriter(w)
+	return &jsonLines{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (j *jsonLines) Write(msg models.ExportedMessage) error {
+	return j.enc.Encode(msg)
+}
+
+func (j *jsonLines) Flush() error {
+	return j.buf.Flush()
+}
+
+var csvHeader = []string{"id", "room", "parent_id", "user_id", "username", "content", "created_at", "edited_at", "deleted_at"}
+
+// csvWriter writes a header row then one row per message, times are RFC 3339 in UTC and empty when unset
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSV(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(msg models.ExportedMessage) error {
+	if !c.headerWritten {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	parentID := ""
+	if msg.ParentID != nil {
+		parentID = strconv.Itoa(*msg.ParentID)
+	}
+
+	return c.w.Write([]string{
+		strconv.Itoa(msg.ID),
+		msg.Room,
+		parentID,
+		strconv.Itoa(msg.UserID),
+		msg.Username,
+		msg.Content,
+		msg.CreatedAt.UTC().Format(time.RFC3339),
+		formatOptional(msg.EditedAt, time.RFC3339),
+		formatOptional(msg.DeletedAt, time.RFC3339),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	if !c.headerWritten {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// markdownTimeLayout is how times are shown in Markdown transcripts
+const markdownTimeLayout = "2006-01-02 15:04:05 UTC"
+
+// markdownEscaper keeps message content from being rendered as Markdown or HTML
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "~", `\~`,
+	"\r\n", " ", "\n", " ",
+)
+
+/*
+markdown writes a transcript with a section per room and a list item per message. Messages must come grouped by
+room, as database.Database.ExportMessages returns them
+*/
+type markdown struct {
+	buf   *bufio.Writer
+	room  string
+	count int
+}
+
+func newMarkdown(w io.Writer) Writer {
+	return &markdown{buf: bufio.NewWriter(w)}
+}
+
+func (m *markdown) Write(msg models.ExportedMessage) error {
+	if m.count == 0 {
+		m.buf.WriteString("# Chat transcript\n")
+	}
+	if m.count == 0 || msg.Room != m.room {
+		fmt.Fprintf(m.buf, "\n## #%s\n\n", markdownEscaper.Replace(msg.Room))
+		m.room = msg.Room
+	}
+	m.count++
+
+	fmt.Fprintf(m.buf, "- `#%d` %s **%s**", msg.ID, msg.CreatedAt.UTC().Format(markdownTimeLayout), markdownEscaper.Replace(msg.Username))
+	if msg.ParentID != nil {
+		fmt.Fprintf(m.buf, " (reply to `#%d`)", *msg.ParentID)
+	}
+	fmt.Fprintf(m.buf, ": %s", markdownEscaper.Replace(msg.Content))
+	if msg.EditedAt != nil {
+		fmt.Fprintf(m.buf, " _(edited %s)_", msg.EditedAt.UTC().Format(markdownTimeLayout))
+	}
+	if msg.DeletedAt != nil {
+		fmt.Fprintf(m.buf, " _(deleted %s)_", msg.DeletedAt.UTC().Format(markdownTimeLayout))
+	}
+	_, err := m.buf.WriteString("\n")
+	return err
+}
+
+func (m *markdown) Flush() error {
+	if m.count == 0 {
+		m.buf.WriteString("# Chat transcript\n\nNo messages\n")
+	}
+	return m.buf.Flush()
+}
+
+func formatOptional(t *time.Time, layout string) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(layout)
+}
@@ -0,0 +1,92 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func testMessages() []models.ExportedMessage {
+	sent := time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+	edited := sent.Add(time.Minute)
+	deleted := sent.Add(time.Hour)
+	parentID := 1
+
+	return []models.ExportedMessage{
+		{Message: models.Message{ID: 1, RoomID: 1, UserID: 2, Username: "alice", Content: "Buy *now*", CreatedAt: sent, EditedAt: &edited}, Room: "general"},
+		{Message: models.Message{ID: 2, RoomID: 1, UserID: 3, ParentID: &parentID, Username: "bob", Content: "why, \"alice\"?", CreatedAt: sent.Add(time.Second)}, Room: "general"},
+		{Message: models.Message{ID: 3, RoomID: 4, UserID: 3, Username: "bob", Content: "oops", CreatedAt: sent.Add(2 * time.Second), DeletedAt: &deleted}, Room: "fx"},
+	}
+}
+
+func export(t *testing.T, name string, messages []models.ExportedMessage) string {
+	format, err := Lookup(name)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	w := format.NewWriter(&out)
+	for _, msg := range messages {
+		require.NoError(t, w.Write(msg))
+	}
+	require.NoError(t, w.Flush())
+	return out.String()
+}
+
+func TestLookup(t *testing.T) {
+	format, err := Lookup("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFormat, format.Name)
+
+	format, err = Lookup("markdown")
+	require.NoError(t, err)
+	assert.Equal(t, "md", format.Extension)
+
+	_, err = Lookup("xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestJSONLines(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(export(t, "jsonl", testMessages()), "\n"), "\n")
+	require.Len(t, lines, 3)
+
+	var reply models.ExportedMessage
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &reply))
+	assert.Equal(t, "general", reply.Room)
+	assert.Equal(t, `why, "alice"?`, reply.Content)
+	require.NotNil(t, reply.ParentID)
+	assert.Equal(t, 1, *reply.ParentID)
+
+	assert.Empty(t, export(t, "jsonl", nil))
+}
+
+func TestCSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(export(t, "csv", testMessages()))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, []string{"1", "general", "", "2", "alice", "Buy *now*", "2026-03-02T14:30:00Z", "2026-03-02T14:31:00Z", ""}, records[1])
+	assert.Equal(t, []string{"2", "general", "1", "3", "bob", `why, "alice"?`, "2026-03-02T14:30:01Z", "", ""}, records[2])
+	assert.Equal(t, "2026-03-02T15:30:00Z", records[3][8])
+
+	assert.Equal(t, strings.Join(csvHeader, ",")+"\n", export(t, "csv", nil), "an empty export still has its header")
+}
+
+func TestMarkdown(t *testing.T) {
+	expected := "# Chat transcript\n" +
+		"\n## #general\n\n" +
+		"- `#1` 2026-03-02 14:30:00 UTC **alice**: Buy \\*now\\* _(edited 2026-03-02 14:31:00 UTC)_\n" +
+		"- `#2` 2026-03-02 14:30:01 UTC **bob** (reply to `#1`): why, \"alice\"?\n" +
+		"\n## #fx\n\n" +
+		"- `#3` 2026-03-02 14:30:02 UTC **bob**: oops _(deleted 2026-03-02 15:30:00 UTC)_\n"
+	assert.Equal(t, expected, export(t, "markdown", testMessages()))
+
+	assert.Equal(t, "# Chat transcript\n\nNo messages\n", export(t, "markdown", nil))
+}
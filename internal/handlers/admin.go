@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go-challenge-financial-chat/internal/chat"
+	"go-challenge-financial-chat/internal/models"
+)
+
+const (
+	// adminLatestMessages is the number of latest public messages listed on the admin dashboard
+	adminLatestMessages = 20
+	// adminVolumeWindow is how far back the recent message volume of the dashboard goes
+	adminVolumeWindow = 24 * time.Hour
+	defaultBanReason  = "Disabled by an admin"
+)
+
+// adminHandler shows the admin dashboard: connected clients, users, message volume and the stock bot's status
+func (h *Handlers) adminHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := h.db.GetUsers()
+	if err != nil {
+		http.Error(w, "Failed to load users", http.StatusInternalServerError)
+		return
+	}
+
+	bans, err := h.db.GetBans()
+	if err != nil {
+		http.Error(w, "Failed to load bans", http.StatusInternalServerError)
+		return
+	}
+	banned := make(map[int]*models.Ban, len(bans))
+	for i := range bans {
+		banned[bans[i].UserID] = &bans[i]
+	}
+
+	volume, err := h.db.GetMessageVolume(time.Now().Add(-adminVolumeWindow))
+	if err != nil {
+		http.Error(w, "Failed to load message volume", http.StatusInternalServerError)
+		return
+	}
+
+	messages, err := h.db.GetLatestMessages(adminLatestMessages)
+	if err != nil {
+		http.Error(w, "Failed to load messages", http.StatusInternalServerError)
+		return
+	}
+
+	roomNames, err := h.publicRoomNames()
+	if err != nil {
+		http.Error(w, "Failed to load rooms", http.StatusInternalServerError)
+		return
+	}
+
+	online := make(map[string]bool)
+	for _, username := range h.hub.OnlineUsers() {
+		online[username] = true
+	}
+
+	bot := h.hub.BotStats()
+	tmpl := template.Must(template.ParseFiles("web/templates/admin.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Username":  sessionFrom(r).Username,
+		"Notice":    r.URL.Query().Get("notice"),
+		"Clients":   h.hub.Clients(),
+		"Users":     users,
+		"Online":    online,
+		"Banned":    banned,
+		"Volume":    volume,
+		"Messages":  messages,
+		"RoomNames": roomNames,
+		"Bot":       bot,
+		"BotStatus": bot.ConsumerStatus(time.Now()),
+	})
+}
+
+// adminDisableHandler bans a user, with the "reason" form value when given
+func (h *Handlers) adminDisableHandler(w http.ResponseWriter, r *http.Request) {
+	session := sessionFrom(r)
+	username := mux.Vars(r)["username"]
+	if username == session.Username {
+		adminRedirect(w, r, "You can't disable your own account")
+		return
+	}
+
+	user, err := h.db.GetUser(username)
+	if err != nil || user.Username == models.BotUsername {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		reason = defaultBanReason
+	}
+
+	err = h.hub.Ban(user, session.UserID, session.Username, reason)
+	if errors.Is(err, chat.ErrAlreadyBanned) {
+		adminRedirect(w, r, username+" is already disabled")
+		return
+	}
+	if err != nil {
+		log.Printf("Error banning %s: %v", username, err)
+		http.Error(w, "Failed to disable user", http.StatusInternalServerError)
+		return
+	}
+
+	adminRedirect(w, r, username+" was disabled")
+}
+
+// adminEnableHandler lifts the ban of a user
+func (h *Handlers) adminEnableHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	user, err := h.db.GetUser(username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.hub.Unban(user, sessionFrom(r).Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		adminRedirect(w, r, username+" is not disabled")
+		return
+	}
+	if err != nil {
+		log.Printf("Error unbanning %s: %v", username, err)
+		http.Error(w, "Failed to enable user", http.StatusInternalServerError)
+		return
+	}
+
+	adminRedirect(w, r, username+" was enabled")
+}
+
+// adminDeleteMessageHandler deletes a message of a public room, removing it from the screens of the room
+func (h *Handlers) adminDeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	message, err := h.db.GetMessage(id)
+	if err != nil || message.DeletedAt != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	roomNames, err := h.publicRoomNames()
+	if err != nil {
+		http.Error(w, "Failed to load rooms", http.StatusInternalServerError)
+		return
+	}
+
+	room, ok := roomNames[message.RoomID]
+	if !ok {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.hub.DeleteMessage(message, room); err != nil {
+		log.Printf("Error deleting message %d: %v", id, err)
+		http.Error(w, "Failed to delete message", http.StatusInternalServerError)
+		return
+	}
+
+	adminRedirect(w, r, "Message #"+strconv.Itoa(id)+" was deleted")
+}
+
+// adminAnnounceHandler sends the "content" form value to every connected client as a system message
+func (h *Handlers) adminAnnounceHandler(w http.ResponseWriter, r *http.Request) {
+	content := strings.TrimSpace(r.FormValue("content"))
+	if content == "" {
+		adminRedirect(w, r, "An announcement needs some text")
+		return
+	}
+
+	h.hub.Announce(content)
+	adminRedirect(w, r, "Announcement sent")
+}
+
+// publicRoomNames maps the IDs of the public rooms to their names
+func (h *Handlers) publicRoomNames() (map[int]string, error) {
+	rooms, err := h.db.GetRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string, len(rooms))
+	for _, room := range rooms {
+		names[room.ID] = room.Name
+	}
+	return names, nil
+}
+
+// adminRedirect sends the admin back to the dashboard with a notice about the action they took
+func adminRedirect(w http.ResponseWriter, r *http.Request, notice string) {
+	http.Redirect(w, r, "/admin?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/models"
+)
+
+// notice returns the notice the admin was redirected to the dashboard with
+func notice(t *testing.T, rec *httptest.ResponseRecorder) string {
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "/admin", location.Path)
+	return location.Query().Get("notice")
+}
+
+func TestAdminActions_Permissions(t *testing.T) {
+	s := newTestServer(t)
+	bob, _ := s.user(t, "bob", models.RoleUser)
+	_, moderatorCookie := s.user(t, "mod", models.RoleModerator)
+
+	general, err := s.db.GetRoom("general")
+	require.NoError(t, err)
+	id, err := s.db.SaveMessage(general.ID, bob.ID, bob.Username, "Hello")
+	require.NoError(t, err)
+
+	for _, target := range []string{
+		"/admin/users/bob/disable",
+		"/admin/users/bob/enable",
+		"/admin/messages/" + strconv.Itoa(id) + "/delete",
+		"/admin/announcements",
+	} {
+		rec := s.do("POST", target, nil, url.Values{"content": {"Hi"}})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, target)
+		rec = s.do("POST", target, moderatorCookie, url.Values{"content": {"Hi"}})
+		assert.Equal(t, http.StatusForbidden, rec.Code, target)
+	}
+
+	_, err = s.db.GetBan(bob.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	message, err := s.db.GetMessage(id)
+	require.NoError(t, err)
+	assert.Nil(t, message.DeletedAt)
+}
+
+func TestAdminActions_DisableEnable(t *testing.T) {
+	s := newTestServer(t)
+	_, cookie := s.user(t, "admin", models.RoleAdmin)
+	bob, _ := s.user(t, "bob", models.RoleUser)
+
+	rec := s.do("POST", "/admin/users/bob/disable", cookie, url.Values{"reason": {"Spam"}})
+	assert.Equal(t, "bob was disabled", notice(t, rec))
+	ban, err := s.db.GetBan(bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Spam", ban.Reason)
+
+	rec = s.do("POST", "/admin/users/bob/disable", cookie, url.Values{})
+	assert.Equal(t, "bob is already disabled", notice(t, rec))
+
+	rec = s.do("POST", "/admin/users/admin/disable", cookie, url.Values{})
+	assert.Equal(t, "You can't disable your own account", notice(t, rec))
+	rec = s.do("POST", "/admin/users/"+models.BotUsername+"/disable", cookie, url.Values{})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = s.do("POST", "/admin/users/bob/enable", cookie, url.Values{})
+	assert.Equal(t, "bob was enabled", notice(t, rec))
+	_, err = s.db.GetBan(bob.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	rec = s.do("POST", "/admin/users/bob/enable", cookie, url.Values{})
+	assert.Equal(t, "bob is not disabled", notice(t, rec))
+
+	rec = s.do("POST", "/admin/users/bob/disable", cookie, url.Values{})
+	notice(t, rec)
+	ban, err = s.db.GetBan(bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, defaultBanReason, ban.Reason)
+}
+
+func TestAdminActions_DeleteMessage(t *testing.T) {
+	s := newTestServer(t)
+	_, cookie := s.user(t, "admin", models.RoleAdmin)
+	alice, _ := s.user(t, "alice", models.RoleUser)
+	bob, _ := s.user(t, "bob", models.RoleUser)
+
+	general, err := s.db.GetRoom("general")
+	require.NoError(t, err)
+	id, err := s.db.SaveMessage(general.ID, bob.ID, bob.Username, "Spam")
+	require.NoError(t, err)
+
+	target := "/admin/messages/" + strconv.Itoa(id) + "/delete"
+	rec := s.do("POST", target, cookie, url.Values{})
+	assert.Equal(t, "Message #"+strconv.Itoa(id)+" was deleted", notice(t, rec))
+	message, err := s.db.GetMessage(id)
+	require.NoError(t, err)
+	assert.NotNil(t, message.DeletedAt)
+
+	rec = s.do("POST", target, cookie, url.Values{})
+	assert.Equal(t, http.StatusNotFound, rec.Code, "messages are deleted once")
+
+	room, err := s.db.OpenDirectRoom(alice.ID, bob.ID)
+	require.NoError(t, err)
+	id, err = s.db.SaveMessage(room.ID, bob.ID, bob.Username, "Secret")
+	require.NoError(t, err)
+
+	rec = s.do("POST", "/admin/messages/"+strconv.Itoa(id)+"/delete", cookie, url.Values{})
+	assert.Equal(t, http.StatusNotFound, rec.Code, "direct messages stay out of the dashboard")
+	message, err = s.db.GetMessage(id)
+	require.NoError(t, err)
+	assert.Nil(t, message.DeletedAt)
+}
+
+func TestAdminActions_Announcement(t *testing.T) {
+	s := newTestServer(t)
+	_, cookie := s.user(t, "admin", models.RoleAdmin)
+
+	rec := s.do("POST", "/admin/announcements", cookie, url.Values{"content": {"  "}})
+	assert.Equal(t, "An announcement needs some text", notice(t, rec))
+
+	rec = s.do("POST", "/admin/announcements", cookie, url.Values{"content": {"Maintenance at noon"}})
+	assert.Equal(t, "Announcement sent", notice(t, rec))
+}
+
+func TestWebsocket_Banned(t *testing.T) {
+	s := newTestServer(t)
+	admin, _ := s.user(t, "admin", models.RoleAdmin)
+	bob, cookie := s.user(t, "bob", models.RoleUser)
+
+	rec := s.do("GET", "/ws?room=general", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	require.NoError(t, s.db.BanUser(bob.ID, admin.ID, "Spam"))
+	rec = s.do("GET", "/ws?room=general", cookie, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "a session that outlived the ban can't connect")
+}
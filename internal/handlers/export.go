@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"go-challenge-financial-chat/internal/daterange"
+	"go-challenge-financial-chat/internal/export"
+	"go-challenge-financial-chat/internal/models"
+)
+
+/*
+exportHandler streams every message between the "from" and "to" dates, deleted ones and direct messages included, as a
+transcript in the "format" query parameter: jsonl (default), csv or markdown. "room" limits the export to one room
+*/
+func (h *Handlers) exportHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := export.Lookup(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, "Invalid format parameter, expected jsonl, csv or markdown", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := daterange.Parse(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filters := models.ExportFilters{From: from, To: to}
+	if name := r.URL.Query().Get("room"); name != "" {
+		room, err := h.db.GetRoom(name)
+		if err != nil {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		filters.RoomID = room.ID
+	}
+
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-export.%s"`, format.Extension))
+
+	out := &sentCounter{ResponseWriter: w}
+	writer := format.NewWriter(out)
+	err = h.db.ExportMessages(filters, writer.Write)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		return
+	}
+
+	log.Printf("Error exporting messages after sending %d bytes: %v", out.sent, err)
+	if out.sent == 0 {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Failed to export messages", http.StatusInternalServerError)
+		return
+	}
+	// the status was sent with the first bytes of the transcript, aborting tells the client it is incomplete
+	panic(http.ErrAbortHandler)
+}
+
+// sentCounter counts the bytes of the response body, the writers of the export formats buffer them before sending
+type sentCounter struct {
+	http.ResponseWriter
+	sent int
+}
+
+func (c *sentCounter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.sent += n
+	return n, err
+}
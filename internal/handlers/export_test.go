@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestExport(t *testing.T) {
+	s := newTestServer(t)
+	_, cookie := s.user(t, "admin", models.RoleAdmin)
+	bob, _ := s.user(t, "bob", models.RoleUser)
+
+	general, err := s.db.GetRoom("general")
+	require.NoError(t, err)
+	_, err = s.db.SaveMessage(general.ID, bob.ID, bob.Username, "Hello")
+	require.NoError(t, err)
+
+	rec := s.do("GET", "/api/export?format=csv&room=general", cookie, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `attachment; filename="chat-export.csv"`, rec.Header().Get("Content-Disposition"))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "Hello")
+
+	for target, code := range map[string]int{
+		"/api/export?format=xml":                    http.StatusBadRequest,
+		"/api/export?from=yesterday":                http.StatusBadRequest,
+		"/api/export?from=2026-03-02&to=2026-03-01": http.StatusBadRequest,
+		"/api/export?room=nowhere":                  http.StatusNotFound,
+	} {
+		rec := s.do("GET", target, cookie, nil)
+		assert.Equal(t, code, rec.Code, target)
+		assert.Empty(t, rec.Header().Get("Content-Disposition"), target)
+	}
+}
@@ -1,22 +1,37 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"html/template"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"go-challenge-financial-chat/internal/auth"
 	"go-challenge-financial-chat/internal/chat"
 	"go-challenge-financial-chat/internal/database"
+	"go-challenge-financial-chat/internal/models"
+)
+
+const (
+	defaultRoom         = "general"
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 100
 )
 
 type Handlers struct {
 	auth *auth.Service
 	hub  *chat.Hub
-	db   *database.DB
+	db   database.Database
 }
 
-func New(authService *auth.Service, hub *chat.Hub, db *database.DB) *Handlers {
+func New(authService *auth.Service, hub *chat.Hub, db database.Database) *Handlers {
 	return &Handlers{
 		auth: authService,
 		hub:  hub,
@@ -31,11 +46,51 @@ func (h *Handlers) SetupRoutes() *mux.Router {
 	r.HandleFunc("/login", h.loginHandler).Methods("GET", "POST")
 	r.HandleFunc("/register", h.registerHandler).Methods("GET", "POST")
 	r.HandleFunc("/chat", h.chatHandler).Methods("GET")
+	r.HandleFunc("/dm", h.directHandler).Methods("GET")
 	r.HandleFunc("/ws", h.websocketHandler).Methods("GET")
+	r.HandleFunc("/api/messages", h.messagesHandler).Methods("GET")
+	r.HandleFunc("/api/messages/{id:[0-9]+}/thread", h.threadHandler).Methods("GET")
+	r.HandleFunc("/api/presence", h.presenceHandler).Methods("GET")
+	r.HandleFunc("/api/search", h.searchHandler).Methods("GET")
+	r.HandleFunc("/api/export", h.requirePermission(auth.PermAdminister, h.exportHandler)).Methods("GET")
+	r.HandleFunc("/api/users/{username}/role", h.requirePermission(auth.PermManageUsers, h.roleHandler)).Methods("POST")
+	r.HandleFunc("/admin", h.requirePermission(auth.PermAdminister, h.adminHandler)).Methods("GET")
+	r.HandleFunc("/admin/users/{username}/disable", h.requirePermission(auth.PermAdminister, h.adminDisableHandler)).Methods("POST")
+	r.HandleFunc("/admin/users/{username}/enable", h.requirePermission(auth.PermAdminister, h.adminEnableHandler)).Methods("POST")
+	r.HandleFunc("/admin/messages/{id:[0-9]+}/delete", h.requirePermission(auth.PermAdminister, h.adminDeleteMessageHandler)).Methods("POST")
+	r.HandleFunc("/admin/announcements", h.requirePermission(auth.PermAdminister, h.adminAnnounceHandler)).Methods("POST")
 	r.HandleFunc("/logout", h.logoutHandler).Methods("POST")
+	r.HandleFunc("/logout-all", h.logoutAllHandler).Methods("POST")
 	return r
 }
 
+type sessionKey struct{}
+
+/*
+requirePermission protects a route so only users whose role grants the permission reach next, which finds their
+session with sessionFrom
+*/
+func (h *Handlers) requirePermission(permission auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := h.auth.Authorize(r, permission)
+		if errors.Is(err, auth.ErrForbidden) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, session)))
+	}
+}
+
+// sessionFrom returns the session stored by requirePermission
+func sessionFrom(r *http.Request) *models.Session {
+	return r.Context().Value(sessionKey{}).(*models.Session)
+}
+
 func (h *Handlers) homeHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/chat", http.StatusSeeOther)
 }
@@ -56,7 +111,10 @@ func (h *Handlers) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.auth.SetSession(w, user.Username)
+	if err := h.auth.SetSession(w, user); err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
 	http.Redirect(w, r, "/chat", http.StatusSeeOther)
 }
 
@@ -79,38 +137,314 @@ func (h *Handlers) registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.auth.SetSession(w, username)
+	user, err := h.db.GetUser(username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.auth.SetSession(w, user); err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
 	http.Redirect(w, r, "/chat", http.StatusSeeOther)
 }
 
 func (h *Handlers) chatHandler(w http.ResponseWriter, r *http.Request) {
-	username, err := h.auth.GetSession(r)
+	session, err := h.auth.GetSession(r)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
+	room, err := h.accessibleRoom(roomName(r), session.UserID)
+	if errors.Is(err, sql.ErrNoRows) && r.URL.Query().Get("room") != "" {
+		http.Redirect(w, r, "/chat", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load room", http.StatusInternalServerError)
+		return
+	}
+
+	rooms, err := h.db.GetRooms()
+	if err != nil {
+		http.Error(w, "Failed to load rooms", http.StatusInternalServerError)
+		return
+	}
+
+	conversations, err := h.db.GetConversations(session.UserID)
+	if err != nil {
+		http.Error(w, "Failed to load conversations", http.StatusInternalServerError)
+		return
+	}
+
+	title := "#" + room.Name
+	for _, c := range conversations {
+		if c.Room.ID == room.ID {
+			title = "@" + c.Peer
+		}
+	}
+
 	tmpl := template.Must(template.ParseFiles("web/templates/chat.html"))
-	tmpl.Execute(w, map[string]string{"Username": username})
+	tmpl.Execute(w, map[string]interface{}{
+		"Username":      session.Username,
+		"Room":          room.Name,
+		"Kind":          room.Kind,
+		"Title":         title,
+		"Rooms":         rooms,
+		"Conversations": conversations,
+		"Admin":         auth.Can(session.Role, auth.PermAdminister),
+	})
+}
+
+// directHandler opens the direct message room with the user named by the "user" query parameter
+func (h *Handlers) directHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := h.auth.GetSession(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	peer, err := h.db.GetUser(r.URL.Query().Get("user"))
+	if err != nil || peer.ID == session.UserID || peer.Username == models.BotUsername {
+		http.Redirect(w, r, "/chat", http.StatusSeeOther)
+		return
+	}
+
+	room, err := h.db.OpenDirectRoom(session.UserID, peer.ID)
+	if err != nil {
+		http.Error(w, "Failed to open conversation", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/chat?room="+url.QueryEscape(room.Name), http.StatusSeeOther)
 }
 
 func (h *Handlers) websocketHandler(w http.ResponseWriter, r *http.Request) {
-	username, err := h.auth.GetSession(r)
+	session, err := h.auth.GetSession(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	user, err := h.db.GetUser(username)
+	err = h.auth.CheckBan(session.UserID)
+	if errors.Is(err, auth.ErrBanned) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check ban", http.StatusInternalServerError)
+		return
+	}
+
+	room, err := h.accessibleRoom(roomName(r), session.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load room", http.StatusInternalServerError)
+		return
+	}
+
+	h.hub.HandleWebSocket(w, r, session.Username, session.UserID, session.Role, room)
+}
+
+/*
+messagesHandler returns a page of room history before the "before" message ID, most recent page when it is omitted
+*/
+func (h *Handlers) messagesHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := h.auth.GetSession(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	before, err := intParam(r, "before", 0)
+	if err != nil || before < 0 {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := intParam(r, "limit", defaultHistoryLimit)
+	if err != nil || limit < 1 || limit > maxHistoryLimit {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	room, err := h.accessibleRoom(roomName(r), session.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load room", http.StatusInternalServerError)
+		return
+	}
+
+	messages, err := h.db.GetRecentMessages(room.ID, before, limit)
+	if err != nil {
+		http.Error(w, "Failed to load messages", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+
+	writeJSON(w, models.HistoryPage{
+		Messages: messages,
+		HasMore:  len(messages) == limit,
+	})
+}
+
+// threadHandler returns a top-level message with its replies
+func (h *Handlers) threadHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := h.auth.GetSession(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	parent, err := h.db.GetMessage(id)
+	if err != nil || parent.DeletedAt != nil || parent.ParentID != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	if ok, err := h.db.CanAccessRoom(parent.RoomID, session.UserID); err != nil || !ok {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	replies, err := h.db.GetThread(parent.ID)
 	if err != nil {
+		http.Error(w, "Failed to load thread", http.StatusInternalServerError)
+		return
+	}
+	if replies == nil {
+		replies = []models.Message{}
+	}
+
+	writeJSON(w, models.Thread{Parent: *parent, Replies: replies})
+}
+
+// presenceHandler lists every user with whether they are online, online users first
+func (h *Handlers) presenceHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.auth.GetSession(r); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	users, err := h.db.GetUsers()
+	if err != nil {
+		http.Error(w, "Failed to load users", http.StatusInternalServerError)
+		return
+	}
+
+	online := h.hub.OnlineUsers()
+	presence := make([]models.Presence, 0, len(users))
+	for _, user := range users {
+		presence = append(presence, models.Presence{
+			Username: user.Username,
+			Online:   slices.Contains(online, user.Username),
+			LastSeen: user.LastSeen,
+		})
+	}
+	slices.SortStableFunc(presence, func(a, b models.Presence) int {
+		if a.Online == b.Online {
+			return 0
+		}
+		if a.Online {
+			return -1
+		}
+		return 1
+	})
+
+	writeJSON(w, presence)
+}
+
+// roleHandler changes the role of a user to the "role" form value
+func (h *Handlers) roleHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	if username == sessionFrom(r).Username {
+		http.Error(w, "You can't change your own role", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.db.GetUser(username)
+	if err != nil || user.Username == models.BotUsername {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	h.hub.HandleWebSocket(w, r, username, user.ID)
+	role := r.FormValue("role")
+	err = h.hub.SetRole(user, role)
+	if errors.Is(err, chat.ErrUnknownRole) {
+		http.Error(w, "Invalid role parameter", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to change role", http.StatusInternalServerError)
+		return
+	}
+
+	user.Role = role
+	writeJSON(w, user)
 }
 
 func (h *Handlers) logoutHandler(w http.ResponseWriter, r *http.Request) {
-	h.auth.ClearSession(w)
+	h.auth.ClearSession(w, r)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (h *Handlers) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.auth.ClearAllSessions(w, r); err != nil && !errors.Is(err, auth.ErrInvalidSession) && !errors.Is(err, http.ErrNoCookie) {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
+
+// accessibleRoom loads a room the user can access, direct rooms of other users are reported as sql.ErrNoRows
+func (h *Handlers) accessibleRoom(name string, userID int) (*models.Room, error) {
+	room, err := h.db.GetRoom(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := h.db.CanAccessRoom(room.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return room, nil
+}
+
+// roomName returns the room requested through the "room" query parameter, falling back to the default room
+func roomName(r *http.Request) string {
+	if room := r.URL.Query().Get("room"); room != "" {
+		return room
+	}
+	return defaultRoom
+}
+
+// intParam parses an optional integer query parameter
+func intParam(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/auth"
+	"go-challenge-financial-chat/internal/broker"
+	"go-challenge-financial-chat/internal/chat"
+	"go-challenge-financial-chat/internal/database"
+	"go-challenge-financial-chat/internal/models"
+)
+
+type testServer struct {
+	db     *database.DB
+	auth   *auth.Service
+	router http.Handler
+}
+
+// newTestServer serves the routes with an in-memory database and broker and a running hub
+func newTestServer(t *testing.T) *testServer {
+	db, err := database.Open("sqlite://:memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Migrate())
+
+	b := broker.NewMemory()
+	t.Cleanup(func() { b.Close() })
+	hub := chat.NewHub(db, b, chat.DefaultRateLimits())
+	go hub.Run()
+
+	authService := auth.NewService(db, []byte("test secret"))
+	return &testServer{db: db, auth: authService, router: New(authService, hub, db).SetupRoutes()}
+}
+
+// user registers a user with the role and returns them with the cookie of a fresh session
+func (s *testServer) user(t *testing.T, username, role string) (*models.User, *http.Cookie) {
+	require.NoError(t, s.db.CreateUser(username, "hash"))
+	user, err := s.db.GetUser(username)
+	require.NoError(t, err)
+	require.NoError(t, s.db.SetUserRole(user.ID, role))
+	user.Role = role
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, s.auth.SetSession(rec, user))
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return user, cookies[0]
+}
+
+// do sends a request with the cookie, when given, and form values as the body of POST requests
+func (s *testServer) do(method, target string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDirectRooms_Access(t *testing.T) {
+	s := newTestServer(t)
+	alice, aliceCookie := s.user(t, "alice", models.RoleUser)
+	bob, _ := s.user(t, "bob", models.RoleUser)
+	_, carolCookie := s.user(t, "carol", models.RoleUser)
+
+	room, err := s.db.OpenDirectRoom(alice.ID, bob.ID)
+	require.NoError(t, err)
+	_, err = s.db.SaveMessage(room.ID, alice.ID, alice.Username, "Secret")
+	require.NoError(t, err)
+
+	target := "/api/messages?room=" + url.QueryEscape(room.Name)
+	rec := s.do("GET", target, aliceCookie, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Secret")
+
+	rec = s.do("GET", target, carolCookie, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "direct rooms of other users look like they don't exist")
+	assert.NotContains(t, rec.Body.String(), "Secret")
+
+	rec = s.do("GET", "/dm?user="+models.BotUsername, aliceCookie, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/chat", rec.Header().Get("Location"), "there is no conversation with the bot")
+	conversations, err := s.db.GetConversations(alice.ID)
+	require.NoError(t, err)
+	assert.Len(t, conversations, 1)
+}
+
+func TestRequirePermission(t *testing.T) {
+	s := newTestServer(t)
+	s.user(t, "bob", models.RoleUser)
+	_, userCookie := s.user(t, "alice", models.RoleUser)
+	_, moderatorCookie := s.user(t, "mod", models.RoleModerator)
+	_, adminCookie := s.user(t, "admin", models.RoleAdmin)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		code   int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user", userCookie, http.StatusForbidden},
+		{"moderator", moderatorCookie, http.StatusForbidden},
+		{"admin", adminCookie, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do("POST", "/api/users/bob/role", tt.cookie, url.Values{"role": {models.RoleModerator}})
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+
+	bob, err := s.db.GetUser("bob")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleModerator, bob.Role, "only the admin changed the role")
+}
+
+func TestRoleHandler(t *testing.T) {
+	s := newTestServer(t)
+	_, cookie := s.user(t, "admin", models.RoleAdmin)
+	s.user(t, "bob", models.RoleUser)
+
+	rec := s.do("POST", "/api/users/admin/role", cookie, url.Values{"role": {models.RoleUser}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the session of the request tells who the admin is")
+	admin, err := s.db.GetUser("admin")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, admin.Role)
+
+	rec = s.do("POST", "/api/users/"+models.BotUsername+"/role", cookie, url.Values{"role": {models.RoleAdmin}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = s.do("POST", "/api/users/nobody/role", cookie, url.Values{"role": {models.RoleAdmin}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = s.do("POST", "/api/users/bob/role", cookie, url.Values{"role": {"root"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = s.do("POST", "/api/users/bob/role", cookie, url.Values{"role": {models.RoleModerator}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"moderator"`)
+	bob, err := s.db.GetUser("bob")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleModerator, bob.Role)
+}
+
+func TestMessages_Paging(t *testing.T) {
+	s := newTestServer(t)
+	alice, cookie := s.user(t, "alice", models.RoleUser)
+	general, err := s.db.GetRoom("general")
+	require.NoError(t, err)
+
+	var ids []int
+	for _, content := range []string{"One", "Two", "Three"} {
+		id, err := s.db.SaveMessage(general.ID, alice.ID, alice.Username, content)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	page := func(query string) models.HistoryPage {
+		rec := s.do("GET", "/api/messages?room=general&"+query, cookie, nil)
+		require.Equal(t, http.StatusOK, rec.Code, query)
+		var page models.HistoryPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		return page
+	}
+	contents := func(page models.HistoryPage) []string {
+		var contents []string
+		for _, msg := range page.Messages {
+			contents = append(contents, msg.Content)
+		}
+		return contents
+	}
+
+	latest := page("limit=2")
+	assert.Equal(t, []string{"Two", "Three"}, contents(latest))
+	assert.True(t, latest.HasMore)
+
+	older := page("limit=2&before=" + strconv.Itoa(ids[1]))
+	assert.Equal(t, []string{"One"}, contents(older))
+	assert.False(t, older.HasMore)
+
+	all := page("")
+	assert.Equal(t, []string{"One", "Two", "Three"}, contents(all), "the limit defaults to a full page")
+	assert.False(t, all.HasMore)
+
+	empty := page("before=" + strconv.Itoa(ids[0]))
+	assert.NotNil(t, empty.Messages)
+	assert.Empty(t, empty.Messages)
+	assert.False(t, empty.HasMore)
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"before=abc", http.StatusBadRequest},
+		{"before=-1", http.StatusBadRequest},
+		{"limit=abc", http.StatusBadRequest},
+		{"limit=0", http.StatusBadRequest},
+		{"limit=" + strconv.Itoa(maxHistoryLimit), http.StatusOK},
+		{"limit=" + strconv.Itoa(maxHistoryLimit+1), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := s.do("GET", "/api/messages?room=general&"+tt.query, cookie, nil)
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+
+	rec := s.do("GET", "/api/messages?room=general", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = s.do("GET", "/api/messages?room=nowhere", cookie, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
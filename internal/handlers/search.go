@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-challenge-financial-chat/internal/daterange"
+	"go-challenge-financial-chat/internal/models"
+)
+
+const maxSearchLimit = 100
+
+/*
+searchHandler finds the messages matching the "q" query parameter in the rooms the user can access, most recent first.
+Results can be narrowed by author with "user", by room with "room" and by date with "from" and "to", both inclusive
+*/
+func (h *Handlers) searchHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := h.auth.GetSession(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := intParam(r, "limit", models.DefaultSearchLimit)
+	if err != nil || limit < 1 || limit > maxSearchLimit {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := daterange.Parse(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filters := models.SearchFilters{
+		ViewerID: session.UserID,
+		Username: strings.TrimSpace(r.URL.Query().Get("user")),
+		From:     from,
+		To:       to,
+		Limit:    limit,
+	}
+
+	if name := r.URL.Query().Get("room"); name != "" {
+		room, err := h.accessibleRoom(name, session.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load room", http.StatusInternalServerError)
+			return
+		}
+		filters.RoomID = room.ID
+	}
+
+	messages, err := h.db.SearchMessages(query, filters)
+	if err != nil {
+		log.Printf("Error searching messages for %q: %v", query, err)
+		http.Error(w, "Failed to search messages", http.StatusInternalServerError)
+		return
+	}
+
+	rooms, err := h.roomTitles(session.UserID)
+	if err != nil {
+		http.Error(w, "Failed to load rooms", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]models.SearchResult, 0, len(messages))
+	for _, message := range messages {
+		room, ok := rooms[message.RoomID]
+		if !ok {
+			continue
+		}
+		results = append(results, models.SearchResult{Message: message, Room: room.Name, Title: room.Title})
+	}
+
+	writeJSON(w, results)
+}
+
+type roomTitle struct {
+	Name  string
+	Title string
+}
+
+// roomTitles maps the IDs of the rooms the user can access to their name and how they are shown: "#room" or "@peer"
+func (h *Handlers) roomTitles(userID int) (map[int]roomTitle, error) {
+	rooms, err := h.db.GetRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	conversations, err := h.db.GetConversations(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make(map[int]roomTitle, len(rooms)+len(conversations))
+	for _, room := range rooms {
+		titles[room.ID] = roomTitle{Name: room.Name, Title: "#" + room.Name}
+	}
+	for _, c := range conversations {
+		titles[c.Room.ID] = roomTitle{Name: c.Room.Name, Title: "@" + c.Peer}
+	}
+	return titles, nil
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestSearch_DirectRooms(t *testing.T) {
+	s := newTestServer(t)
+	alice, aliceCookie := s.user(t, "alice", models.RoleUser)
+	bob, _ := s.user(t, "bob", models.RoleUser)
+	_, carolCookie := s.user(t, "carol", models.RoleUser)
+
+	room, err := s.db.OpenDirectRoom(alice.ID, bob.ID)
+	require.NoError(t, err)
+	_, err = s.db.SaveMessage(room.ID, alice.ID, alice.Username, "Secret plans")
+	require.NoError(t, err)
+	general, err := s.db.GetRoom("general")
+	require.NoError(t, err)
+	_, err = s.db.SaveMessage(general.ID, bob.ID, bob.Username, "Public plans")
+	require.NoError(t, err)
+
+	search := func(cookie *http.Cookie, query url.Values) []models.SearchResult {
+		rec := s.do("GET", "/api/search?"+query.Encode(), cookie, nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var results []models.SearchResult
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		return results
+	}
+
+	results := search(aliceCookie, url.Values{"q": {"plans"}})
+	require.Len(t, results, 2)
+	assert.Equal(t, "Public plans", results[0].Content)
+	assert.Equal(t, "Secret plans", results[1].Content)
+	assert.Equal(t, room.Name, results[1].Room)
+	assert.Equal(t, "@bob", results[1].Title)
+
+	results = search(carolCookie, url.Values{"q": {"plans"}})
+	require.Len(t, results, 1, "direct messages of other users are never found")
+	assert.Equal(t, "Public plans", results[0].Content)
+	assert.Empty(t, search(carolCookie, url.Values{"q": {"secret"}}))
+
+	rec := s.do("GET", "/api/search?"+url.Values{"q": {"secret"}, "room": {room.Name}}.Encode(), carolCookie, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "direct rooms of other users look like they don't exist")
+	assert.NotContains(t, rec.Body.String(), "Secret")
+
+	rec = s.do("GET", "/api/search?q=plans", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -5,20 +5,98 @@ import (
 )
 
 type User struct {
-	ID           int       `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	ID           int        `json:"id" db:"id"`
+	Username     string     `json:"username" db:"username"`
+	PasswordHash string     `json:"-" db:"password_hash"`
+	Role         string     `json:"role" db:"role"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	LastSeen     *time.Time `json:"last_seen,omitempty" db:"last_seen"`
 }
 
-type Message struct {
-	ID        int       `json:"id" db:"id"`
+// User roles, from least to most privileged: moderators keep the rooms in order, admins also manage the users
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+/*
+The stock bot posts as the user with this reserved name, seeded by the initial migration. Its ID depends on the
+database, nobody can log in as it
+*/
+const BotUsername = "StockBot"
+
+// Presence is whether a user has a chat open, and when they were last connected otherwise
+type Presence struct {
+	Username string     `json:"username"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Ban keeps a user out of the chat, BannedBy is the moderator who banned them
+type Ban struct {
+	UserID    int       `json:"user_id" db:"user_id"`
+	Reason    string    `json:"reason" db:"reason"`
+	BannedBy  int       `json:"banned_by" db:"banned_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type Session struct {
+	ID        string    `json:"-" db:"id"`
 	UserID    int       `json:"user_id" db:"user_id"`
 	Username  string    `json:"username" db:"username"`
-	Content   string    `json:"content" db:"content"`
+	Role      string    `json:"role" db:"role"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type Room struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Kind      string    `json:"kind" db:"kind"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// Room kinds: public rooms are open to every user, direct rooms hold the messages between two users
+const (
+	RoomPublic = "public"
+	RoomDirect = "direct"
+)
+
+// Conversation is a direct message room as seen by one of its members
+type Conversation struct {
+	Room   Room   `json:"room"`
+	Peer   string `json:"peer"`
+	Unread int    `json:"unread"`
+}
+
+type Message struct {
+	ID         int        `json:"id" db:"id"`
+	RoomID     int        `json:"room_id" db:"room_id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	ParentID   *int       `json:"parent_id,omitempty" db:"parent_id"`
+	Username   string     `json:"username" db:"username"`
+	Content    string     `json:"content" db:"content"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	EditedAt   *time.Time `json:"edited_at,omitempty" db:"edited_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	ReplyCount int        `json:"reply_count" db:"reply_count"`
+	Reactions  []Reaction `json:"reactions,omitempty"`
+}
+
+// Reaction is the aggregate of one emoji on a message, Users lists who reacted in the order they did
+type Reaction struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// Thread is a message with its replies, oldest first
+type Thread struct {
+	Parent  Message   `json:"parent"`
+	Replies []Message `json:"replies"`
+}
+
 type StockQuote struct {
 	Symbol string  `json:"symbol"`
 	Price  float64 `json:"price"`
@@ -26,9 +104,145 @@ type StockQuote struct {
 	Time   string  `json:"time"`
 }
 
+// StockRequest is published by the chat server for every stock command and consumed by the bot
+type StockRequest struct {
+	ID          string    `json:"id"`
+	StockCode   string    `json:"stock_code"`
+	User        string    `json:"user"`
+	Room        string    `json:"room"`
+	Private     bool      `json:"private"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+const (
+	StockErrorNotFound    = "not_found"
+	StockErrorUnavailable = "unavailable"
+)
+
+/*
+StockResponse is the result the bot publishes for every stock request, it carries either the quote or an error reason
+*/
+type StockResponse struct {
+	RequestID string      `json:"request_id"`
+	StockCode string      `json:"stock_code"`
+	User      string      `json:"user"`
+	Room      string      `json:"room"`
+	Private   bool        `json:"private"`
+	Quote     *StockQuote `json:"quote,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// ProtocolVersion is the version of the WebSocket protocol spoken by the server, it is sent in every frame
+const ProtocolVersion = 1
+
+// WebSocket frame types
+const (
+	TypeChat        = "chat"
+	TypeCommand     = "command"
+	TypeSystem      = "system"
+	TypePresence    = "presence"
+	TypeTyping      = "typing"
+	TypeError       = "error"
+	TypeAck         = "ack"
+	TypeHistoryPage = "history-page"
+	TypeEdit        = "edit"
+	TypeDelete      = "delete"
+	TypeReply       = "reply"
+	TypeReact       = "react"
+	TypeUnreact     = "unreact"
+	TypeReactions   = "reactions"
+	TypeDM          = "dm"
+	TypeRead        = "read"
+)
+
+// Statuses carried by presence and typing frames
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+	TypingStarted = "started"
+	TypingStopped = "stopped"
+)
+
+/*
+WSMessage is the envelope of every WebSocket frame, Type tells which fields are meaningful and Ref is an optional
+client chosen ID echoed back in the ack or error answering that frame
+*/
 type WSMessage struct {
-	Type     string    `json:"type"`
-	Username string    `json:"username"`
-	Content  string    `json:"content"`
-	Time     time.Time `json:"time"`
+	Version   int        `json:"v"`
+	Type      string     `json:"type"`
+	Ref       string     `json:"ref,omitempty"`
+	ID        int        `json:"id,omitempty"`
+	Room      string     `json:"room"`
+	Username  string     `json:"username"`
+	Content   string     `json:"content"`
+	Private   bool       `json:"private,omitempty"`
+	RequestID string     `json:"request_id,omitempty"`
+	Time      time.Time  `json:"time"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+
+	// reply frames carry the parent message and its updated number of replies
+	ParentID   int `json:"parent_id,omitempty"`
+	ReplyCount int `json:"reply_count,omitempty"`
+
+	// presence and typing frames carry the user's Status
+	Status string `json:"status,omitempty"`
+
+	// dm frames carry the recipient of the direct message
+	To string `json:"to,omitempty"`
+
+	// react and unreact frames carry the Emoji, the reactions frame answering them the message's Reactions
+	Emoji     string     `json:"emoji,omitempty"`
+	Reactions []Reaction `json:"reactions,omitempty"`
+
+	// history-page fields: the client sends Before, the server answers with Messages and HasMore
+	Before   int       `json:"before,omitempty"`
+	Messages []Message `json:"messages,omitempty"`
+	HasMore  bool      `json:"has_more,omitempty"`
+}
+
+// DefaultSearchLimit is the number of messages a search returns when no limit is given
+const DefaultSearchLimit = 50
+
+// SearchFilters narrow a message search, zero values match everything
+type SearchFilters struct {
+	ViewerID int    // only messages of the rooms this user can access are found
+	Username string // author of the messages
+	RoomID   int
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	Limit    int       // DefaultSearchLimit when zero
+}
+
+// SearchResult is a message found by a search with its room, Title is how the room is shown: "#room" or "@peer"
+type SearchResult struct {
+	Message
+	Room  string `json:"room"`
+	Title string `json:"title"`
+}
+
+// ExportFilters select the messages of an export, zero values match everything
+type ExportFilters struct {
+	RoomID int
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+}
+
+// ExportedMessage is a message of an export with the name of its room
+type ExportedMessage struct {
+	Message
+	Room string `json:"room"`
+}
+
+// RoomVolume counts the live messages of a public room, or of all direct rooms together when Kind is direct
+type RoomVolume struct {
+	Room   string `json:"room"`
+	Kind   string `json:"kind"`
+	Total  int    `json:"total"`
+	Recent int    `json:"recent"` // posted since the time the volume was asked from
+}
+
+// HistoryPage is a page of room history, oldest message first
+type HistoryPage struct {
+	Messages []Message `json:"messages"`
+	HasMore  bool      `json:"has_more"`
 }
@@ -0,0 +1,156 @@
+package stock
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-challenge-financial-chat/internal/models"
+)
+
+const DefaultStooqURL = "https://stooq.com"
+
+// ErrQuoteNotFound is returned when the provider has no quote for the requested symbol
+var ErrQuoteNotFound = errors.New("quote not found")
+
+// QuoteProvider is a source of stock quotes for the bot
+type QuoteProvider interface {
+	GetQuote(ctx context.Context, stockCode string) (*models.StockQuote, error)
+}
+
+/*
+NewProvider builds the quote provider selected by kind: "stooq" queries the stooq.com CSV API at baseURL,
+"file" serves quotes from a CSV fixture at fixturesPath
+*/
+func NewProvider(kind, baseURL, fixturesPath string) (QuoteProvider, error) {
+	switch kind {
+	case "", "stooq":
+		if baseURL == "" {
+			baseURL = DefaultStooqURL
+		}
+		return NewStooqProvider(baseURL), nil
+	case "file":
+		return NewFileProvider(fixturesPath)
+	default:
+		return nil, fmt.Errorf("unknown stock provider %q", kind)
+	}
+}
+
+type StooqProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewStooqProvider(baseURL string) *StooqProvider {
+	return &StooqProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *StooqProvider) GetQuote(ctx context.Context, stockCode string) (*models.StockQuote, error) {
+	quoteURL := fmt.Sprintf("%s/q/l/?s=%s&f=sd2t2ohlcv&h&e=csv", p.baseURL, url.QueryEscape(stockCode))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, quoteURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	records, err := readRecords(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseQuote(records[0])
+}
+
+/*
+FileProvider serves quotes from a CSV file in the stooq format, it is meant for tests and offline demos
+*/
+type FileProvider struct {
+	quotes map[string][]string
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := readRecords(f)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string][]string, len(records))
+	for _, record := range records {
+		quotes[strings.ToLower(record[0])] = record
+	}
+
+	return &FileProvider{quotes: quotes}, nil
+}
+
+func (p *FileProvider) GetQuote(_ context.Context, stockCode string) (*models.StockQuote, error) {
+	record, ok := p.quotes[strings.ToLower(stockCode)]
+	if !ok {
+		return nil, fmt.Errorf("%w: no quote for %s in fixtures", ErrQuoteNotFound, stockCode)
+	}
+
+	return parseQuote(record)
+}
+
+// readRecords reads a stooq CSV document and returns its data rows without the header
+func readRecords(r io.Reader) ([][]string, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < 2 {
+		return nil, fmt.Errorf("insufficient data received")
+	}
+
+	return records[1:], nil
+}
+
+func parseQuote(data []string) (*models.StockQuote, error) {
+	if len(data) < 7 {
+		return nil, fmt.Errorf("invalid CSV format")
+	}
+
+	// stooq answers unknown symbols with a row where every value is N/D
+	if data[6] == "N/D" {
+		return nil, fmt.Errorf("%w: %s", ErrQuoteNotFound, data[0])
+	}
+
+	closePrice, err := strconv.ParseFloat(data[6], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid close price: %v", err)
+	}
+
+	return &models.StockQuote{
+		Symbol: strings.ToUpper(data[0]),
+		Price:  closePrice,
+		Date:   data[1],
+		Time:   data[2],
+	}, nil
+}
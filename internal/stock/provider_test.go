@@ -0,0 +1,76 @@
+package stock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStooqProvider_GetQuote(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/q/l/", r.URL.Path)
+		switch r.URL.Query().Get("s") {
+		case "aapl.us":
+			w.Write([]byte("Symbol,Date,Time,Open,High,Low,Close,Volume\nAAPL.US,2025-06-13,22:00:10,199.73,200.37,195.7,196.45,51447349\n"))
+		case "xyz":
+			w.Write([]byte("Symbol,Date,Time,Open,High,Low,Close,Volume\nXYZ,N/D,N/D,N/D,N/D,N/D,N/D,N/D\n"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewStooqProvider(server.URL)
+
+	t.Run("Valid symbol", func(t *testing.T) {
+		quote, err := provider.GetQuote(context.Background(), "aapl.us")
+		require.NoError(t, err)
+		assert.Equal(t, "AAPL.US", quote.Symbol)
+		assert.Equal(t, 196.45, quote.Price)
+		assert.Equal(t, "2025-06-13", quote.Date)
+	})
+
+	t.Run("Unknown symbol", func(t *testing.T) {
+		quote, err := provider.GetQuote(context.Background(), "xyz")
+		assert.ErrorIs(t, err, ErrQuoteNotFound)
+		assert.Nil(t, quote)
+	})
+
+	t.Run("Server error", func(t *testing.T) {
+		quote, err := provider.GetQuote(context.Background(), "broken")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrQuoteNotFound)
+		assert.Nil(t, quote)
+	})
+}
+
+func TestFileProvider_GetQuote(t *testing.T) {
+	provider, err := NewFileProvider("testdata/quotes.csv")
+	require.NoError(t, err)
+
+	quote, err := provider.GetQuote(context.Background(), "msft.us")
+	require.NoError(t, err)
+	assert.Equal(t, "MSFT.US", quote.Symbol)
+	assert.Equal(t, 474.96, quote.Price)
+
+	quote, err = provider.GetQuote(context.Background(), "nope.us")
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+	assert.Nil(t, quote)
+}
+
+func TestNewProvider(t *testing.T) {
+	provider, err := NewProvider("", "", "")
+	require.NoError(t, err)
+	assert.IsType(t, &StooqProvider{}, provider)
+
+	provider, err = NewProvider("file", "", "testdata/quotes.csv")
+	require.NoError(t, err)
+	assert.IsType(t, &FileProvider{}, provider)
+
+	_, err = NewProvider("bloomberg", "", "")
+	assert.Error(t, err)
+}
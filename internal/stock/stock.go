@@ -2,40 +2,26 @@ package stock
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
-	"fmt"
-	"github.com/segmentio/kafka-go"
+	"errors"
 	"log"
-	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
+	"go-challenge-financial-chat/internal/broker"
 	"go-challenge-financial-chat/internal/models"
 )
 
 type Service struct {
-	kafkaReader *kafka.Reader
-	kafkaWriter *kafka.Writer
+	broker       broker.Broker
+	subscription broker.Subscription
+	provider     QuoteProvider
 }
 
-func NewService(brokers string) *Service {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{brokers},
-		Topic:   "stock-requests",
-		GroupID: "stock-bot",
-	})
-
-	writer := &kafka.Writer{
-		Addr:     kafka.TCP(brokers),
-		Topic:    "stock-quotes",
-		Balancer: &kafka.LeastBytes{},
-	}
-
+func NewService(b broker.Broker, provider QuoteProvider) *Service {
 	return &Service{
-		kafkaReader: reader,
-		kafkaWriter: writer,
+		broker:       b,
+		subscription: b.Subscribe(broker.TopicStockRequests, "stock-bot"),
+		provider:     provider,
 	}
 }
 
@@ -43,89 +29,63 @@ func (s *Service) Start() {
 	log.Println("Stock bot started, listening for requests...")
 
 	for {
-		msg, err := s.kafkaReader.ReadMessage(context.Background())
+		msg, err := s.subscription.ReadMessage(context.Background())
+		if errors.Is(err, broker.ErrClosed) {
+			return
+		}
 		if err != nil {
-			log.Printf("Error reading from Kafka: %v", err)
+			log.Printf("Error reading stock requests: %v", err)
 			time.Sleep(time.Second)
 			continue
 		}
 
-		var request map[string]string
+		var request models.StockRequest
 		if err := json.Unmarshal(msg.Value, &request); err != nil {
 			log.Printf("Error unmarshaling request: %v", err)
 			continue
 		}
 
-		stockCode := request["stock_code"]
-		user := request["user"]
+		stockCode := request.StockCode
+		log.Printf("Processing stock request %s for %s from user %s in room %s", request.ID, stockCode, request.User, request.Room)
 
-		log.Printf("Processing stock request for %s from user %s", stockCode, user)
+		response := models.StockResponse{
+			RequestID: request.ID,
+			StockCode: stockCode,
+			User:      request.User,
+			Room:      request.Room,
+			Private:   request.Private,
+		}
 
-		quote, err := s.fetchStockQuote(stockCode)
-		if err != nil {
+		quote, err := s.provider.GetQuote(context.Background(), stockCode)
+		switch {
+		case errors.Is(err, ErrQuoteNotFound):
+			log.Printf("No stock quote found for %s: %v", stockCode, err)
+			response.Error = models.StockErrorNotFound
+		case err != nil:
 			log.Printf("Error fetching stock quote for %s: %v", stockCode, err)
-			continue
+			response.Error = models.StockErrorUnavailable
+		default:
+			response.Quote = quote
 		}
 
-		quoteBytes, _ := json.Marshal(quote)
-		err = s.kafkaWriter.WriteMessages(context.Background(),
-			kafka.Message{
+		responseBytes, _ := json.Marshal(response)
+		err = s.broker.Publish(context.Background(), broker.TopicStockQuotes,
+			broker.Message{
 				Key:   []byte(stockCode),
-				Value: quoteBytes,
+				Value: responseBytes,
 			},
 		)
 
 		if err != nil {
-			log.Printf("Error sending quote to Kafka: %v", err)
+			log.Printf("Error publishing stock response: %v", err)
 		}
 	}
 }
 
-func (s *Service) fetchStockQuote(stockCode string) (*models.StockQuote, error) {
-	url := fmt.Sprintf("https://stooq.com/q/l/?s=%s&f=sd2t2ohlcv&h&e=csv", stockCode)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	reader := csv.NewReader(resp.Body)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
-	}
-
-	if len(records) < 2 {
-		return nil, fmt.Errorf("insufficient data received")
-	}
-
-	data := records[1]
-	if len(data) < 7 {
-		return nil, fmt.Errorf("invalid CSV format")
-	}
-
-	closePrice, err := strconv.ParseFloat(data[6], 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid close price: %v", err)
-	}
-
-	return &models.StockQuote{
-		Symbol: strings.ToUpper(data[0]),
-		Price:  closePrice,
-		Date:   data[1],
-		Time:   data[2],
-	}, nil
-}
-
 func (s *Service) Close() {
 	log.Println("Closing stock bot service...")
-	if err := s.kafkaReader.Close(); err != nil {
-		log.Printf("Error stopping Kafka reader: %v", err)
-	}
-
-	if err := s.kafkaWriter.Close(); err != nil {
-		log.Printf("Error stopping Kafka writer: %v", err)
+	if err := s.subscription.Close(); err != nil {
+		log.Printf("Error closing stock requests subscription: %v", err)
 	}
 
 	log.Println("Stock bot service closed.")
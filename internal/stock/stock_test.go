@@ -0,0 +1,69 @@
+package stock
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-challenge-financial-chat/internal/broker"
+	"go-challenge-financial-chat/internal/models"
+)
+
+func TestService_Start(t *testing.T) {
+	provider, err := NewFileProvider("testdata/quotes.csv")
+	require.NoError(t, err)
+
+	b := broker.NewMemory()
+	defer b.Close()
+
+	responses := b.Subscribe(broker.TopicStockQuotes, "test")
+	service := NewService(b, provider)
+	go service.Start()
+	defer service.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name          string
+		request       models.StockRequest
+		expectedError string
+		expectedPrice float64
+	}{
+		{
+			name:          "Known symbol",
+			request:       models.StockRequest{ID: "1", StockCode: "aapl.us", User: "alice", Room: "general"},
+			expectedPrice: 196.45,
+		},
+		{
+			name:          "Unknown symbol",
+			request:       models.StockRequest{ID: "2", StockCode: "xyz", User: "bob", Room: "fx", Private: true},
+			expectedError: models.StockErrorNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _ := json.Marshal(tt.request)
+			require.NoError(t, b.Publish(ctx, broker.TopicStockRequests, broker.Message{Value: value}))
+
+			msg, err := responses.ReadMessage(ctx)
+			require.NoError(t, err)
+
+			var response models.StockResponse
+			require.NoError(t, json.Unmarshal(msg.Value, &response))
+			assert.Equal(t, tt.request.ID, response.RequestID)
+			assert.Equal(t, tt.request.User, response.User)
+			assert.Equal(t, tt.request.Room, response.Room)
+			assert.Equal(t, tt.request.Private, response.Private)
+			assert.Equal(t, tt.expectedError, response.Error)
+			if tt.expectedError == "" {
+				require.NotNil(t, response.Quote)
+				assert.Equal(t, tt.expectedPrice, response.Quote.Price)
+			}
+		})
+	}
+}
@@ -1,3 +1,9 @@
+const PROTOCOL_VERSION = 1;
+// Minimum interval between typing frames, and how long someone is shown typing if their "stopped" frame never arrives
+const TYPING_INTERVAL = 2000;
+const TYPING_EXPIRY = 6000;
+const REACTION_EMOJI = ['👍', '❤️', '😂', '🎉', '😮', '👀'];
+
 class ChatApp {
     constructor() {
         this.ws = null;
@@ -6,13 +12,44 @@ class ChatApp {
         this.reconnectDelay = 1000;
 
         this.messagesContainer = document.getElementById('messages');
+        this.scrollContainer = document.querySelector('.messages-container');
         this.messageInput = document.getElementById('messageInput');
         this.sendButton = document.getElementById('sendButton');
         this.connectionStatus = document.getElementById('connectionStatus');
         this.statusIndicator = this.connectionStatus.querySelector('.status-indicator');
         this.statusText = this.connectionStatus.querySelector('.status-text');
 
+        this.threadPanel = document.getElementById('threadPanel');
+        this.threadMessages = document.getElementById('threadMessages');
+        this.threadInput = document.getElementById('threadInput');
+        this.threadSendButton = document.getElementById('threadSendButton');
+        this.openThreadId = 0;
+
+        this.searchForm = document.getElementById('searchForm');
+        this.searchFilters = document.getElementById('searchFilters');
+        this.searchPanel = document.getElementById('searchPanel');
+        this.searchResults = document.getElementById('searchResults');
+        this.contextBanner = document.getElementById('contextBanner');
+
+        // Search results link to /chat?room=...&message=ID, with reply=ID when the match is a reply in the thread of ID
+        const params = new URLSearchParams(window.location.search);
+        this.focusId = Number(params.get('message')) || 0;
+        this.focusReplyId = Number(params.get('reply')) || 0;
+
         this.currentUser = document.querySelector('.chat-header .user-info strong').textContent;
+        this.currentRoom = document.querySelector('.chat-container').dataset.room;
+        this.directRoom = document.querySelector('.chat-container').dataset.kind === 'direct';
+        this.conversationList = document.getElementById('conversationList');
+        this.onlineUsersList = document.getElementById('onlineUsers');
+        this.onlineUsers = new Set();
+
+        this.typingIndicator = document.getElementById('typingIndicator');
+        this.typingUsers = new Map();
+        this.lastTypingSent = 0;
+
+        this.oldestMessageId = 0;
+        this.hasMoreHistory = false;
+        this.loadingHistory = false;
 
         this.initializeEventListeners();
         this.connect();
@@ -28,17 +65,58 @@ class ChatApp {
             }
         });
 
+        // Edit, delete, thread and reaction buttons of messages
+        [this.messagesContainer, this.threadMessages].forEach((container) => {
+            container.addEventListener('click', (e) => {
+                const button = e.target.closest('[data-action]');
+                if (!button) return;
+
+                const messageElement = button.closest('.message');
+                this.handleMessageAction(button.dataset.action, messageElement, button.dataset.emoji);
+            });
+        });
+
+        document.getElementById('threadCloseButton').addEventListener('click', () => this.closeThread());
+        this.threadSendButton.addEventListener('click', () => this.sendReply());
+        this.threadInput.addEventListener('keypress', (e) => {
+            if (e.key === 'Enter' && !e.shiftKey) {
+                e.preventDefault();
+                this.sendReply();
+            }
+        });
+
+        this.searchForm.addEventListener('submit', (e) => {
+            e.preventDefault();
+            this.search();
+        });
+        this.searchFilters.addEventListener('change', () => this.search());
+        this.searchFilters.addEventListener('submit', (e) => {
+            e.preventDefault();
+            this.search();
+        });
+        document.getElementById('searchCloseButton').addEventListener('click', () => {
+            this.searchPanel.hidden = true;
+        });
+
+        // Load older messages when scrolled to the top
+        this.scrollContainer.addEventListener('scroll', () => {
+            if (this.scrollContainer.scrollTop < 50) {
+                this.loadOlderMessages();
+            }
+        });
+
         // Auto-resize input and limit length
         this.messageInput.addEventListener('input', (e) => {
             if (e.target.value.length > 500) {
                 e.target.value = e.target.value.substring(0, 500);
             }
+            this.notifyTyping(e.target.value);
         });
     }
 
     connect() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${window.location.host}/ws`;
+        const wsUrl = `${protocol}//${window.location.host}/ws?room=${encodeURIComponent(this.currentRoom)}`;
 
         this.updateConnectionStatus('connecting', 'Connecting...');
 
@@ -51,11 +129,12 @@ class ChatApp {
                 this.updateConnectionStatus('connected', 'Connected');
                 this.sendButton.disabled = false;
                 this.messageInput.disabled = false;
+                this.loadPresence();
             };
 
             this.ws.onmessage = (event) => {
                 const message = JSON.parse(event.data);
-                this.displayMessage(message);
+                this.handleFrame(message);
             };
 
             this.ws.onclose = (event) => {
@@ -111,22 +190,488 @@ class ChatApp {
         if (!content) return;
 
         const message = {
-            type: 'message',
-            content: content,
-            time: new Date().toISOString()
+            v: PROTOCOL_VERSION,
+            type: content.startsWith('/') ? 'command' : 'chat',
+            content: content
         };
 
         this.ws.send(JSON.stringify(message));
         this.messageInput.value = '';
         this.messageInput.focus();
+        this.lastTypingSent = 0;
+    }
+
+    // Tells the room the user is typing a message, commands are not announced
+    notifyTyping(value) {
+        const now = Date.now();
+        if (!value.trim() || value.startsWith('/') || now - this.lastTypingSent < TYPING_INTERVAL) return;
+
+        this.lastTypingSent = now;
+        this.send({ type: 'typing' });
+    }
+
+    handleTyping(message) {
+        if (message.room !== this.currentRoom || message.username === this.currentUser) return;
+
+        clearTimeout(this.typingUsers.get(message.username));
+        if (message.status === 'started') {
+            this.typingUsers.set(message.username, setTimeout(() => {
+                this.typingUsers.delete(message.username);
+                this.renderTyping();
+            }, TYPING_EXPIRY));
+        } else {
+            this.typingUsers.delete(message.username);
+        }
+        this.renderTyping();
+    }
+
+    renderTyping() {
+        const names = [...this.typingUsers.keys()].sort();
+        if (names.length === 0) {
+            this.typingIndicator.textContent = '';
+        } else if (names.length === 1) {
+            this.typingIndicator.textContent = `${names[0]} is typing…`;
+        } else if (names.length === 2) {
+            this.typingIndicator.textContent = `${names[0]} and ${names[1]} are typing…`;
+        } else {
+            this.typingIndicator.textContent = 'Several people are typing…';
+        }
+    }
+
+    sendReply() {
+        const content = this.threadInput.value.trim();
+        if (!content || !this.openThreadId) return;
+
+        this.send({ type: 'reply', parent_id: this.openThreadId, content: content });
+        this.threadInput.value = '';
+        this.threadInput.focus();
+    }
+
+    send(frame) {
+        if (!this.ws || this.ws.readyState !== WebSocket.OPEN) {
+            console.log('WebSocket not connected');
+            return;
+        }
+
+        this.ws.send(JSON.stringify({ v: PROTOCOL_VERSION, ...frame }));
+    }
+
+    handleMessageAction(action, messageElement, emoji) {
+        const id = Number(messageElement.dataset.messageId);
+
+        if (action === 'edit') {
+            const current = messageElement.dataset.content;
+            const content = prompt('Edit message', current);
+            if (content && content.trim() && content !== current) {
+                this.send({ type: 'edit', id: id, content: content.trim() });
+            }
+        } else if (action === 'delete') {
+            if (confirm('Delete this message?')) {
+                this.send({ type: 'delete', id: id });
+            }
+        } else if (action === 'thread') {
+            this.openThread(id);
+        } else if (action === 'pick-reaction') {
+            const picker = messageElement.querySelector('.reaction-picker');
+            picker.hidden = !picker.hidden;
+        } else if (action === 'react') {
+            messageElement.querySelector('.reaction-picker').hidden = true;
+            const reacted = messageElement.querySelector(`.reaction.own[data-emoji="${emoji}"]`);
+            this.send({ type: reacted ? 'unreact' : 'react', id: id, emoji: emoji });
+        }
+    }
+
+    // A message can be shown both in the room and in the open thread panel
+    findMessageElements(id) {
+        return document.querySelectorAll(`.message[data-message-id="${id}"]`);
+    }
+
+    applyEdit(message) {
+        this.findMessageElements(message.id).forEach((element) => {
+            element.dataset.content = message.content;
+            element.querySelector('.message-content').innerHTML = this.formatContent(message);
+            element.querySelector('.message-edited').hidden = false;
+        });
+    }
+
+    applyDelete(message) {
+        this.findMessageElements(message.id).forEach((element) => element.remove());
+
+        if (message.id === this.openThreadId) {
+            this.closeThread();
+        }
+        if (message.parent_id) {
+            this.findMessageElements(message.parent_id).forEach((element) => {
+                const count = Number(element.dataset.replyCount || 1) - 1;
+                this.updateReplyCount(element, count);
+            });
+        }
+    }
+
+    applyReactions(message) {
+        this.findMessageElements(message.id).forEach((element) => this.renderReactions(element, message.reactions || []));
+    }
+
+    renderReactions(element, reactions) {
+        const container = element.querySelector('.message-reactions');
+        if (!container) return;
+
+        container.innerHTML = '';
+        reactions.forEach((reaction) => {
+            const button = document.createElement('button');
+            button.type = 'button';
+            button.className = 'reaction';
+            if (reaction.users.includes(this.currentUser)) {
+                button.classList.add('own');
+            }
+            button.dataset.action = 'react';
+            button.dataset.emoji = reaction.emoji;
+            button.title = reaction.users.join(', ');
+            button.textContent = `${reaction.emoji} ${reaction.count}`;
+            container.appendChild(button);
+        });
+    }
+
+    applyReply(message) {
+        this.findMessageElements(message.parent_id).forEach((element) => this.updateReplyCount(element, message.reply_count));
+
+        if (message.parent_id === this.openThreadId) {
+            this.threadMessages.appendChild(this.createMessageElement(message));
+            this.threadMessages.scrollTop = this.threadMessages.scrollHeight;
+        }
+    }
+
+    updateReplyCount(element, count) {
+        element.dataset.replyCount = count;
+        const button = element.querySelector('[data-action="thread"]');
+        if (button) button.textContent = this.replyLabel(count);
+    }
+
+    replyLabel(count) {
+        if (count === 0) return 'Reply';
+        return count === 1 ? '1 reply' : `${count} replies`;
+    }
+
+    async openThread(id) {
+        try {
+            const response = await fetch(`/api/messages/${id}/thread`);
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            const thread = await response.json();
+
+            this.openThreadId = thread.parent.id;
+            this.threadMessages.innerHTML = '';
+            this.threadMessages.appendChild(this.createMessageElement(this.fromStoredMessage(thread.parent)));
+            thread.replies.forEach((reply) => this.threadMessages.appendChild(this.createMessageElement(this.fromStoredMessage(reply))));
+
+            this.threadPanel.hidden = false;
+            this.threadMessages.scrollTop = this.threadMessages.scrollHeight;
+            this.threadInput.focus();
+        } catch (error) {
+            console.error('Failed to load thread:', error);
+        }
+    }
+
+    closeThread() {
+        this.openThreadId = 0;
+        this.threadPanel.hidden = true;
+        this.threadMessages.innerHTML = '';
+    }
+
+    handleFrame(message) {
+        switch (message.type) {
+            case 'chat':
+            case 'system':
+            case 'error':
+                this.displayMessage(message);
+                break;
+            case 'edit':
+                this.applyEdit(message);
+                break;
+            case 'delete':
+                this.applyDelete(message);
+                break;
+            case 'reply':
+                this.applyReply(message);
+                break;
+            case 'reactions':
+                this.applyReactions(message);
+                break;
+            case 'dm':
+                this.handleDirectMessage(message);
+                break;
+            case 'typing':
+                this.handleTyping(message);
+                break;
+            case 'presence':
+                if (message.status === 'online') {
+                    this.onlineUsers.add(message.username);
+                } else {
+                    this.onlineUsers.delete(message.username);
+                }
+                this.renderOnlineUsers();
+                break;
+            case 'history-page':
+                this.displayHistoryPage(message.messages || [], message.has_more, message.before > 0);
+                if (this.focusId && !message.before) {
+                    this.focusMessage();
+                }
+                break;
+            case 'ack':
+                break;
+            default:
+                console.log('Ignoring unsupported frame type:', message.type);
+        }
+    }
+
+    async search() {
+        const query = this.searchForm.elements.q.value.trim();
+        if (!query) return;
+
+        const params = new URLSearchParams({ q: query });
+        new FormData(this.searchFilters).forEach((value, name) => {
+            if (value.trim()) params.set(name, value.trim());
+        });
+
+        this.searchPanel.hidden = false;
+        try {
+            const response = await fetch(`/api/search?${params}`);
+            if (!response.ok) {
+                throw new Error(await response.text());
+            }
+            this.renderSearchResults(await response.json());
+        } catch (error) {
+            this.searchResults.innerHTML = `<p class="search-empty">${this.escapeHtml(error.message)}</p>`;
+        }
+    }
+
+    renderSearchResults(results) {
+        if (results.length === 0) {
+            this.searchResults.innerHTML = '<p class="search-empty">No messages found</p>';
+            return;
+        }
+
+        this.searchResults.innerHTML = results.map((result) => {
+            const params = new URLSearchParams({ room: result.room, message: result.parent_id || result.id });
+            if (result.parent_id) {
+                params.set('reply', result.id);
+            }
+            const time = new Date(result.created_at).toLocaleString([], { dateStyle: 'short', timeStyle: 'short' });
+            return `
+                <a class="search-result" href="/chat?${params}">
+                    <span class="message-header">${this.escapeHtml(result.title)} · ${this.escapeHtml(result.username)}</span>
+                    <span class="search-result-content">${this.escapeHtml(result.content)}</span>
+                    <span class="message-time">${time}${result.parent_id ? ' · in a thread' : ''}</span>
+                </a>`;
+        }).join('');
+    }
+
+    // Scrolls to the message the page was opened on, loading the history around it when it's not in the latest page
+    async focusMessage() {
+        const id = this.focusId;
+        this.focusId = 0;
+
+        let element = this.messagesContainer.querySelector(`.message[data-message-id="${id}"]`);
+        if (!element) {
+            try {
+                const params = new URLSearchParams({ room: this.currentRoom, before: id + 1, limit: 50 });
+                const response = await fetch(`/api/messages?${params}`);
+                if (!response.ok) {
+                    throw new Error(`HTTP ${response.status}`);
+                }
+                const page = await response.json();
+                this.displayHistoryPage(page.messages, page.has_more, false);
+                this.contextBanner.hidden = false;
+            } catch (error) {
+                console.error('Failed to load message context:', error);
+                return;
+            }
+            element = this.messagesContainer.querySelector(`.message[data-message-id="${id}"]`);
+        }
+        if (!element) return;
+
+        element.classList.add('highlight');
+        element.scrollIntoView({ block: 'center' });
+
+        if (this.focusReplyId) {
+            await this.openThread(id);
+            const reply = this.threadMessages.querySelector(`.message[data-message-id="${this.focusReplyId}"]`);
+            if (reply) {
+                reply.classList.add('highlight');
+                reply.scrollIntoView({ block: 'center' });
+            }
+        }
+    }
+
+    async loadPresence() {
+        try {
+            const response = await fetch('/api/presence');
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            const presence = await response.json();
+            this.onlineUsers = new Set(presence.filter((p) => p.online).map((p) => p.username));
+            this.renderOnlineUsers();
+        } catch (error) {
+            console.error('Failed to load presence:', error);
+        }
+    }
+
+    renderOnlineUsers() {
+        this.onlineUsersList.innerHTML = '';
+        [...this.onlineUsers].sort().forEach((username) => {
+            const item = document.createElement('li');
+            if (username === this.currentUser) {
+                item.textContent = `${username} (you)`;
+            } else {
+                const link = document.createElement('a');
+                link.href = `/dm?user=${encodeURIComponent(username)}`;
+                link.title = 'Send a direct message';
+                link.textContent = username;
+                item.appendChild(link);
+            }
+            this.onlineUsersList.appendChild(item);
+        });
+    }
+
+    // Direct messages reach every tab of both users: shown in their conversation, flagged as unread elsewhere
+    handleDirectMessage(message) {
+        if (message.room === this.currentRoom) {
+            this.displayMessage({ ...message, type: 'chat' });
+            this.markRead(message.id);
+            return;
+        }
+
+        const sent = message.username === this.currentUser;
+        const link = this.findConversationLink(message.room, sent ? message.to : message.username);
+        if (sent) {
+            this.displayMessage({ type: 'system', room: this.currentRoom, content: `Direct message sent to @${message.to}`, time: message.time });
+            return;
+        }
+
+        const badge = link.querySelector('.unread-badge');
+        badge.textContent = Number(badge.hidden ? 0 : badge.textContent) + 1;
+        badge.hidden = false;
+    }
+
+    findConversationLink(room, peer) {
+        let link = this.conversationList.querySelector(`.dm-link[data-room="${room}"]`);
+        if (!link) {
+            link = document.createElement('a');
+            link.href = `/chat?room=${encodeURIComponent(room)}`;
+            link.className = 'room-link dm-link';
+            link.dataset.room = room;
+            link.innerHTML = `@${this.escapeHtml(peer)} <span class="unread-badge" hidden>0</span>`;
+            this.conversationList.appendChild(link);
+        }
+        return link;
+    }
+
+    markRead(id) {
+        if (this.directRoom) {
+            this.send({ type: 'read', id: id });
+        }
     }
 
     displayMessage(message) {
+        if (message.room && message.room !== this.currentRoom) return;
+
+        // A reply to a stock request replaces its "fetching" placeholder
+        if (message.request_id) {
+            const pending = this.messagesContainer.querySelector(`.message.pending[data-request-id="${message.request_id}"]`);
+            if (pending) pending.remove();
+        }
+
+        this.messagesContainer.appendChild(this.createMessageElement(message));
+        this.scrollToBottom();
+    }
+
+    // Renders a page of stored messages, older pages are prepended keeping the scroll position
+    displayHistoryPage(messages, hasMore, older) {
+        this.hasMoreHistory = hasMore;
+
+        if (!older) {
+            this.messagesContainer.innerHTML = '';
+        }
+
+        if (messages.length > 0) {
+            this.oldestMessageId = messages[0].id;
+        }
+
+        const fragment = document.createDocumentFragment();
+        messages.forEach((msg) => fragment.appendChild(this.createMessageElement(this.fromStoredMessage(msg))));
+
+        if (!older && messages.length > 0) {
+            this.markRead(messages[messages.length - 1].id);
+        }
+
+        if (older) {
+            const previousHeight = this.scrollContainer.scrollHeight;
+            this.messagesContainer.insertBefore(fragment, this.messagesContainer.firstChild);
+            this.scrollContainer.scrollTop += this.scrollContainer.scrollHeight - previousHeight;
+        } else {
+            this.messagesContainer.appendChild(fragment);
+            this.scrollToBottom();
+        }
+    }
+
+    async loadOlderMessages() {
+        if (this.loadingHistory || !this.hasMoreHistory || this.oldestMessageId === 0) return;
+
+        this.loadingHistory = true;
+        try {
+            const params = new URLSearchParams({ room: this.currentRoom, before: this.oldestMessageId, limit: 50 });
+            const response = await fetch(`/api/messages?${params}`);
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            const page = await response.json();
+            this.displayHistoryPage(page.messages, page.has_more, true);
+        } catch (error) {
+            console.error('Failed to load older messages:', error);
+        } finally {
+            this.loadingHistory = false;
+        }
+    }
+
+    // Converts a message returned by the history API into the shape of a chat frame
+    fromStoredMessage(msg) {
+        return {
+            type: msg.parent_id ? 'reply' : 'chat',
+            id: msg.id,
+            parent_id: msg.parent_id,
+            reply_count: msg.reply_count,
+            reactions: msg.reactions,
+            username: msg.username,
+            content: msg.content,
+            time: msg.created_at,
+            edited_at: msg.edited_at
+        };
+    }
+
+    createMessageElement(message) {
         const messageElement = document.createElement('div');
         messageElement.className = 'message';
+        if (message.request_id) {
+            messageElement.dataset.requestId = message.request_id;
+        }
+        if (message.id) {
+            messageElement.dataset.messageId = message.id;
+            messageElement.dataset.content = message.content;
+        }
+        if (message.type === 'chat') {
+            messageElement.dataset.replyCount = message.reply_count || 0;
+        }
 
         // Determine message type
-        if (message.username === this.currentUser) {
+        if (message.type === 'system' && message.request_id) {
+            messageElement.classList.add('bot', 'pending');
+        } else if (message.type === 'system') {
+            messageElement.classList.add('system');
+        } else if (message.type === 'error') {
+            messageElement.classList.add('error');
+        } else if (message.username === this.currentUser) {
             messageElement.classList.add('own');
         } else if (message.username === 'StockBot') {
             messageElement.classList.add('bot');
@@ -137,19 +682,44 @@ class ChatApp {
         const time = new Date(message.time);
         const timeString = time.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
 
+        const visibility = message.private ? ' <span class="message-private">(only visible to you)</span>' : '';
+
+        let actions = message.id && (message.type === 'chat' || message.type === 'reply') && message.username === this.currentUser
+            ? '<button type="button" class="message-action" data-action="edit">Edit</button><button type="button" class="message-action" data-action="delete">Delete</button>'
+            : '';
+        if (message.id && message.type === 'chat') {
+            actions += `<button type="button" class="message-action" data-action="thread">${this.replyLabel(message.reply_count || 0)}</button>`;
+        }
+
+        const stored = message.id && (message.type === 'chat' || message.type === 'reply');
+        if (stored) {
+            actions += '<button type="button" class="message-action" data-action="pick-reaction">React</button>';
+        }
+        const picker = REACTION_EMOJI
+            .map((emoji) => `<button type="button" class="reaction-option" data-action="react" data-emoji="${emoji}">${emoji}</button>`)
+            .join('');
+
         messageElement.innerHTML = `
-            <div class="message-header">${message.username}</div>
-            <div class="message-content">${this.escapeHtml(message.content)}</div>
-            <div class="message-time">${timeString}</div>
+            <div class="message-header">${this.escapeHtml(message.username || 'System')}${visibility}</div>
+            <div class="message-content">${this.formatContent(message)}</div>
+            <div class="message-time">${timeString} <span class="message-edited"${message.edited_at ? '' : ' hidden'}>(edited)</span>${actions}</div>
+            ${stored ? `<div class="reaction-picker" hidden>${picker}</div><div class="message-reactions"></div>` : ''}
         `;
 
-        this.messagesContainer.appendChild(messageElement);
-        this.scrollToBottom();
+        if (stored) {
+            this.renderReactions(messageElement, message.reactions || []);
+        }
+
+        return messageElement;
+    }
 
-        // Keep only last 50 messages in DOM
-        while (this.messagesContainer.children.length > 50) {
-            this.messagesContainer.removeChild(this.messagesContainer.firstChild);
+    // Renders "/me waves" messages as "alice waves"
+    formatContent(message) {
+        const content = message.content || '';
+        if ((message.type === 'chat' || message.type === 'reply' || message.type === 'edit') && content.startsWith('/me ')) {
+            return `<em>${this.escapeHtml(message.username)} ${this.escapeHtml(content.slice(4))}</em>`;
         }
+        return this.escapeHtml(content);
     }
 
     escapeHtml(text) {
@@ -159,7 +729,7 @@ class ChatApp {
     }
 
     scrollToBottom() {
-        this.messagesContainer.scrollTop = this.messagesContainer.scrollHeight;
+        this.scrollContainer.scrollTop = this.scrollContainer.scrollHeight;
     }
 }
 